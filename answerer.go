@@ -1,12 +1,13 @@
 package xconnwebrtc
 
 import (
+	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pion/webrtc/v4"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wampproto-go/serializers"
 	"github.com/xconnio/xconn-go"
@@ -26,19 +27,61 @@ type Answerer struct {
 	onWAMPDataChannel func(channel *webrtc.DataChannel, serializer serializers.Serializer)
 	onDataChannel     func(channel *webrtc.DataChannel, firstMessage []byte)
 	onIceCandidate    func(candidate *webrtc.ICECandidate)
+	onEndOfCandidates func()
 	cachedCandidates  []webrtc.ICECandidateInit
+	candidateFilter   CandidateFilter
+	// negotiated holds what the handshake of each encrypted or keepalive WAMP
+	// channel agreed on until NewWebRTCPeer picks it up.
+	negotiated map[*webrtc.DataChannel]negotiation
+	// sessions are the WAMP channels admitted so far, for
+	// AnswerConfig.MaxSessions.
+	sessions []*webrtc.DataChannel
+	onEvent  func(event ConnectionEvent)
+	logger   *slog.Logger
+	// keepalive, if set, is started on every WAMP channel's peer that agreed
+	// to it in the handshake.
+	keepalive *KeepaliveConfig
 
 	sync.Mutex
 }
 
 func NewAnswerer() *Answerer {
-	return &Answerer{}
+	return &Answerer{
+		negotiated: make(map[*webrtc.DataChannel]negotiation),
+		logger:     slog.Default(),
+	}
+}
+
+// negotiation is what a WAMP channel's handshake agreed on beyond the
+// serializer.
+type negotiation struct {
+	cipher    *e2eCipher
+	keepalive bool
+}
+
+// NewWebRTCPeer wraps a channel handed to the OnWAMPDataChannel callback,
+// like the package-level NewWebRTCPeer, additionally encrypting it if it was
+// negotiated with AnswerConfig.Encryption, and pinging the remote with
+// AnswerConfig.Keepalive if the handshake agreed on keepalive.
+func (a *Answerer) NewWebRTCPeer(channel *webrtc.DataChannel) xconn.Peer {
+	a.Lock()
+	negotiated := a.negotiated[channel]
+	delete(a.negotiated, channel)
+	logger, keepalive := a.logger, a.keepalive
+	a.Unlock()
+
+	peer := newWebRTCPeer(channel, negotiated.cipher, logger)
+	if negotiated.keepalive {
+		peer.startKeepalive(keepalive)
+	}
+	return peer
 }
 
 // OnWAMPDataChannel registers a callback fired for every data channel whose
 // first message identifies it as WAMP, first channel or not — each one is an
 // independent WAMP session sharing this connection. See OnDataChannel for the
-// synchronous-callback caveat, which applies here too.
+// synchronous-callback caveat, which applies here too. Wrap the channel with
+// Answerer.NewWebRTCPeer so encrypted channels stay encrypted.
 func (a *Answerer) OnWAMPDataChannel(callback func(channel *webrtc.DataChannel, serializer serializers.Serializer)) {
 	a.Lock()
 	defer a.Unlock()
@@ -57,54 +100,82 @@ func (a *Answerer) OnDataChannel(callback func(channel *webrtc.DataChannel, firs
 	a.onDataChannel = callback
 }
 
+// Answer answers offer. Its candidates are batched according to
+// answerConfig.TrickleMode, or by default the mode the offerer reported, with
+// trickleAfter as the TrickleModeCutoff cutoff.
 func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter time.Duration) (*Answer, error) {
 	start := time.Now()
-	end := start.Add(trickleAfter)
 
-	connection, err := NewFilteredPeerConnection(answerConfig.ICEServers)
+	mode := answerConfig.TrickleMode
+	if mode == "" {
+		mode = offer.Trickle
+	}
+	if err := mode.validate(); err != nil {
+		return nil, err
+	}
+	if answerConfig.Keepalive != nil {
+		if err := answerConfig.Keepalive.validate(); err != nil {
+			return nil, err
+		}
+	}
+	batcher := newCandidateBatcher(mode, trickleAfter)
+
+	connection, err := newPeerConnection(answerConfig.ICEServers, answerConfig.ICEPolicy, answerConfig.Certificate,
+		answerConfig.Logger, answerConfig.SettingEngine)
 	if err != nil {
 		return nil, err
 	}
+	logger := loggerOrDefault(answerConfig.Logger)
 
 	a.Lock()
 	a.connection = connection
+	a.candidateFilter = answerConfig.RemoteCandidateFilter
+	a.onEvent = answerConfig.OnEvent
+	a.logger = logger
+	a.keepalive = answerConfig.Keepalive
 	a.Unlock()
 
 	connection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
-		log.Debugf("answerer ICE connection state: %s (+%s)", state, time.Since(start))
+		logger.Debug("answerer ICE connection state changed", "state", state, "elapsed", time.Since(start))
+		emitEvent(answerConfig.OnEvent, ConnectionEvent{Type: EventICEStateChanged, ICEState: state})
 	})
+	watchDTLS(connection, answerConfig.OnEvent)
 
 	if err = connection.SetRemoteDescription(offer.Description); err != nil {
 		return nil, err
 	}
 
-	done := make(chan struct{})
-	var trickle = false
-	var initialCandidates []webrtc.ICECandidateInit
 	connection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate == nil {
-			log.Debugf("answerer ICE gathering complete (+%s)", time.Since(start))
+			logger.Debug("answerer ICE gathering complete", "elapsed", time.Since(start))
+			emitEvent(answerConfig.OnEvent, ConnectionEvent{Type: EventCandidateGathered})
+			if !batcher.complete() {
+				a.Lock()
+				cb := a.onEndOfCandidates
+				a.Unlock()
+				if cb != nil {
+					go cb()
+				}
+			}
 			return
 		}
 
-		if trickle || time.Now().After(end) {
-			a.Lock()
-			cb := a.onIceCandidate
-			a.Unlock()
-			if cb != nil {
-				go cb(candidate)
-			}
-		} else {
-			initialCandidates = append(initialCandidates, candidate.ToJSON())
-			// host candidate gathering is done, any further candidates should
-			// be signaled with Trickle ICE.
-			if candidate.Typ != webrtc.ICECandidateTypeHost {
-				trickle = true
-				select {
-				case done <- struct{}{}:
-				default:
-				}
-			}
+		if !answerConfig.ICEPolicy.allows(candidate) {
+			return
+		}
+		emitEvent(answerConfig.OnEvent, ConnectionEvent{
+			Type:      EventCandidateGathered,
+			Candidate: candidate.ToJSON().Candidate,
+		})
+		if batcher.add(candidate) {
+			return
+		}
+
+		a.Lock()
+		cb := a.onIceCandidate
+		a.Unlock()
+		if cb != nil {
+			go cb(candidate)
 		}
 	})
 
@@ -119,6 +190,15 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 	legacySerializers := xconn.SerializersByWSSubProtocol()
 	var firstChannel atomic.Bool
 
+	limits := handshakeLimits{
+		serializers:    answerConfig.Serializers,
+		encryption:     answerConfig.Encryption,
+		minMessageSize: answerConfig.MinMessageSize,
+		admit: func(channel *webrtc.DataChannel) bool {
+			return a.admitSession(channel, answerConfig.MaxSessions)
+		},
+	}
+
 	// A channel's first message decides what it is: a WAMP RawSocket-style
 	// magic-byte handshake makes it a new WAMP session; anything else is handed
 	// to onDataChannel, first message included. The handler below only ever fires
@@ -126,8 +206,16 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 	// on the raw path, onDataChannel's contract requires the caller to
 	// replace it too.
 	connection.OnDataChannel(func(d *webrtc.DataChannel) {
-		if firstChannel.CompareAndSwap(false, true) {
+		emitEvent(answerConfig.OnEvent, ConnectionEvent{Type: EventDataChannelOpened, Label: d.Label()})
+		if firstChannel.CompareAndSwap(false, true) && answerConfig.Encryption == nil {
 			if serializer, ok := legacySerializers[d.Protocol()]; ok {
+				id, _ := rawSocketSerializerID(serializer)
+				if !allowsSerializer(limits.serializers, id) || !limits.admit(d) {
+					_ = d.Close()
+					return
+				}
+				emitEvent(answerConfig.OnEvent, ConnectionEvent{Type: EventHandshakeDone, Label: d.Label()})
+
 				a.Lock()
 				cb := a.onWAMPDataChannel
 				a.Unlock()
@@ -138,45 +226,24 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 			}
 		}
 
-		detected := false
-		d.OnMessage(func(msg webrtc.DataChannelMessage) {
-			if detected {
-				return
-			}
-			detected = true
-
-			serializerID, ok := wampHandshake(msg.Data)
-			if !ok {
-				a.Lock()
-				cb := a.onDataChannel
-				a.Unlock()
-				if cb != nil {
-					cb(d, msg.Data)
-				}
-				return
-			}
-
-			serializer, ok := serializersByRawSocketID[serializerID]
-			if !ok {
-				log.Debugf("answerer: unsupported serializer %d in handshake on channel %q", serializerID, d.Label())
-				return
-			}
-
-			respBytes, err := buildHandshake(serializerID)
-			if err != nil {
-				log.Debugf("answerer: failed to build handshake response: %v", err)
-				return
+		acceptHandshake(d, limits, logger, func(channel *webrtc.DataChannel,
+			serializer serializers.Serializer, cipher *e2eCipher, keepalive bool) {
+			emitEvent(answerConfig.OnEvent, ConnectionEvent{Type: EventHandshakeDone, Label: channel.Label()})
+			a.Lock()
+			if cipher != nil || keepalive {
+				a.negotiated[channel] = negotiation{cipher: cipher, keepalive: keepalive}
 			}
-			if err = d.Send(respBytes); err != nil {
-				log.Debugf("answerer: failed to send handshake response: %v", err)
-				return
+			cb := a.onWAMPDataChannel
+			a.Unlock()
+			if cb != nil {
+				cb(channel, serializer)
 			}
-
+		}, func(channel *webrtc.DataChannel, firstMessage []byte) {
 			a.Lock()
-			cb := a.onWAMPDataChannel
+			cb := a.onDataChannel
 			a.Unlock()
 			if cb != nil {
-				cb(d, serializer)
+				cb(channel, firstMessage)
 			}
 		})
 	})
@@ -191,31 +258,45 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 	}
 
 	for _, candidate := range offer.Candidates {
-		if err = connection.AddICECandidate(candidate); err != nil {
-			log.Debugf("failed to add offer ICE candidate: %v", err)
+		if err = a.AddICECandidate(candidate); err != nil {
+			logger.Debug("failed to add offer ICE candidate", "error", err)
 		}
 	}
 
 	a.Lock()
 	for _, candidate := range a.cachedCandidates {
-		if err = connection.AddICECandidate(candidate); err != nil {
-			log.Debugf("failed to add cached ICE candidate: %v", err)
+		if err = a.addICECandidate(candidate); err != nil {
+			logger.Debug("failed to add cached ICE candidate", "error", err)
 		}
 	}
 	a.cachedCandidates = nil
 	a.Unlock()
 
-	select {
-	case <-done:
-	case <-time.After(time.Until(end)):
-	}
-
 	return &Answer{
-		Candidates:  initialCandidates,
+		Candidates:  batcher.wait(),
 		Description: answer,
+		Trickle:     batcher.mode,
 	}, nil
 }
 
+// admitSession records channel as a WAMP session unless max sessions are
+// already open on the connection; zero means unlimited.
+func (a *Answerer) admitSession(channel *webrtc.DataChannel, maxSessions int) bool {
+	a.Lock()
+	defer a.Unlock()
+
+	a.sessions = slices.DeleteFunc(a.sessions, func(session *webrtc.DataChannel) bool {
+		state := session.ReadyState()
+		return state == webrtc.DataChannelStateClosing || state == webrtc.DataChannelStateClosed
+	})
+	if maxSessions > 0 && len(a.sessions) >= maxSessions {
+		return false
+	}
+
+	a.sessions = append(a.sessions, channel)
+	return true
+}
+
 func (a *Answerer) OnIceCandidate(callback func(candidate *webrtc.ICECandidate)) {
 	a.Lock()
 	defer a.Unlock()
@@ -223,6 +304,20 @@ func (a *Answerer) OnIceCandidate(callback func(candidate *webrtc.ICECandidate))
 	a.onIceCandidate = callback
 }
 
+// OnEndOfCandidates registers a callback fired once local ICE gathering has
+// finished, if the end-of-candidates marker didn't already ride in the answer
+// and must be trickled like the candidates before it.
+func (a *Answerer) OnEndOfCandidates(callback func()) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.onEndOfCandidates = callback
+}
+
+// AddICECandidate validates a remote candidate against the offer and the
+// configured CandidateFilter, then adds it. Candidates arriving before Answer
+// are cached until it runs. An empty candidate marks the end of the offerer's
+// candidates.
 func (a *Answerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	a.Lock()
 	defer a.Unlock()
@@ -231,8 +326,20 @@ func (a *Answerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 		a.cachedCandidates = append(a.cachedCandidates, candidate)
 		return nil
 	} else {
-		return a.connection.AddICECandidate(candidate)
+		return a.addICECandidate(candidate)
+	}
+}
+
+func (a *Answerer) addICECandidate(candidate webrtc.ICECandidateInit) error {
+	if err := validateRemoteCandidate(a.connection.RemoteDescription(), a.candidateFilter, candidate); err != nil {
+		return err
+	}
+
+	if err := a.connection.AddICECandidate(candidate); err != nil {
+		return err
 	}
+	emitEvent(a.onEvent, ConnectionEvent{Type: EventCandidateReceived, Candidate: candidate.Candidate})
+	return nil
 }
 
 // Connection returns the underlying PeerConnection, or nil if not yet established.
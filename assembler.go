@@ -7,6 +7,17 @@ import (
 
 const MtuSize = 16 * 1024
 
+// Values of the header byte starting every DataChannel message of a WAMP
+// session.
+const (
+	chunkMore  byte = 0
+	chunkFinal byte = 1
+	// chunkPing and chunkPong frame keepalive probes, which are never part
+	// of a WAMP message; see KeepaliveConfig.
+	chunkPing byte = 2
+	chunkPong byte = 3
+)
+
 type WebRTCMessageAssembler struct {
 	buffer *bytes.Buffer
 	mtu    int
@@ -39,12 +50,12 @@ func (m *WebRTCMessageAssembler) ChunkMessage(message []byte) chan []byte {
 			}
 			chunk := message[start:end]
 
-			var isFinal byte = 0
+			header := chunkMore
 			if i == totalChunks-1 {
-				isFinal = 1
+				header = chunkFinal
 			}
 
-			chunks <- append([]byte{isFinal}, chunk...)
+			chunks <- append([]byte{header}, chunk...)
 		}
 		close(chunks)
 	}()
@@ -61,9 +72,7 @@ func (m *WebRTCMessageAssembler) Feed(data []byte) []byte {
 	}
 
 	m.buffer.Write(data[1:])
-	isFinal := data[0]
-
-	if isFinal == 1 {
+	if data[0] == chunkFinal {
 		out := make([]byte, m.buffer.Len())
 		copy(out, m.buffer.Bytes())
 		m.buffer.Reset()
@@ -0,0 +1,161 @@
+package xconnwebrtc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrCandidateRejected is returned when a remote ICE candidate fails
+// validation against the remote description or a CandidateFilter.
+var ErrCandidateRejected = errors.New("remote ICE candidate rejected")
+
+// endOfCandidates is the trickle message signaling that the sender has
+// finished gathering: a candidate with an empty candidate string, as in the
+// W3C WebRTC API.
+func endOfCandidates() webrtc.ICECandidateInit {
+	return webrtc.ICECandidateInit{}
+}
+
+func isEndOfCandidates(candidate webrtc.ICECandidateInit) bool {
+	return strings.TrimPrefix(candidate.Candidate, "candidate:") == ""
+}
+
+// CandidateDelivery decides how the answerer publishes its trickled ICE
+// candidates to the offerer. Candidates from the offerer always go to the
+// shared TopicAnswererOnCandidate, which only the provider subscribes to.
+type CandidateDelivery string
+
+const (
+	// CandidateDeliveryBroadcast publishes on the shared topic, so every
+	// subscribed client receives every peer's candidates and filters them by
+	// request ID.
+	CandidateDeliveryBroadcast CandidateDelivery = "broadcast"
+	// CandidateDeliveryPerRequest publishes on a per-request topic: the shared
+	// topic suffixed with "." and the request ID, which the offerer picks.
+	CandidateDeliveryPerRequest CandidateDelivery = "topic"
+	// CandidateDeliveryEligible publishes on the shared topic with only the
+	// offerer's signaling session eligible to receive the event.
+	CandidateDeliveryEligible CandidateDelivery = "eligible"
+)
+
+func (d CandidateDelivery) validate() error {
+	switch d {
+	case "", CandidateDeliveryBroadcast, CandidateDeliveryPerRequest, CandidateDeliveryEligible:
+		return nil
+	default:
+		return fmt.Errorf("unknown candidate delivery %q", d)
+	}
+}
+
+// candidateTopic returns the topic candidates for requestID are published on
+// under delivery.
+func candidateTopic(topic string, delivery CandidateDelivery, requestID string) string {
+	if delivery == CandidateDeliveryPerRequest {
+		return topic + "." + requestID
+	}
+	return topic
+}
+
+// CandidateFilter restricts which remote ICE candidates are added to a
+// PeerConnection. The zero value accepts every candidate.
+type CandidateFilter struct {
+	DisableIPv4 bool
+	DisableIPv6 bool
+	// RejectPrivate rejects loopback, link-local, private-range (RFC 1918,
+	// RFC 4193) and mDNS ".local" candidates.
+	RejectPrivate bool
+	// Types, if not empty, are the only candidate types accepted: e.g. just
+	// webrtc.ICECandidateTypeRelay to match a relay-only ICEPolicy on the
+	// remote side too, or every type but webrtc.ICECandidateTypeHost.
+	Types []webrtc.ICECandidateType
+}
+
+func (f CandidateFilter) check(candidate ice.Candidate) error {
+	if len(f.Types) > 0 {
+		typ, err := webrtc.NewICECandidateType(candidate.Type().String())
+		if err != nil || !slices.Contains(f.Types, typ) {
+			return fmt.Errorf("%s candidate is not allowed", candidate.Type())
+		}
+	}
+
+	address := candidate.Address()
+	ip := net.ParseIP(address)
+	if ip == nil {
+		if f.RejectPrivate && strings.HasSuffix(address, ".local") {
+			return fmt.Errorf("mDNS address %q is not allowed", address)
+		}
+		return nil
+	}
+
+	if ip.To4() != nil {
+		if f.DisableIPv4 {
+			return fmt.Errorf("IPv4 address %s is not allowed", ip)
+		}
+	} else if f.DisableIPv6 {
+		return fmt.Errorf("IPv6 address %s is not allowed", ip)
+	}
+
+	if f.RejectPrivate && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+		return fmt.Errorf("private address %s is not allowed", ip)
+	}
+
+	return nil
+}
+
+// validateRemoteCandidate checks candidate against the media sections of the
+// remote description (if already applied) and against filter. End-of-candidates
+// messages always pass.
+func validateRemoteCandidate(remote *webrtc.SessionDescription, filter CandidateFilter,
+	candidate webrtc.ICECandidateInit) error {
+
+	if isEndOfCandidates(candidate) {
+		return nil
+	}
+
+	if remote != nil {
+		// Parse a copy: Unmarshal caches its result in the description, which
+		// may be the PeerConnection's own.
+		description := webrtc.SessionDescription{Type: remote.Type, SDP: remote.SDP}
+		parsed, err := description.Unmarshal()
+		if err != nil {
+			return fmt.Errorf("failed to parse remote description: %w", err)
+		}
+
+		mids := make([]string, 0, len(parsed.MediaDescriptions))
+		for _, media := range parsed.MediaDescriptions {
+			mid, _ := media.Attribute("mid")
+			mids = append(mids, mid)
+		}
+
+		if candidate.SDPMLineIndex != nil && int(*candidate.SDPMLineIndex) >= len(mids) {
+			return fmt.Errorf("%w: sdpMLineIndex %d out of range", ErrCandidateRejected, *candidate.SDPMLineIndex)
+		}
+
+		if candidate.SDPMid != nil {
+			if !slices.Contains(mids, *candidate.SDPMid) {
+				return fmt.Errorf("%w: unknown sdpMid %q", ErrCandidateRejected, *candidate.SDPMid)
+			}
+			if candidate.SDPMLineIndex != nil && mids[*candidate.SDPMLineIndex] != *candidate.SDPMid {
+				return fmt.Errorf("%w: sdpMid %q does not match sdpMLineIndex %d", ErrCandidateRejected,
+					*candidate.SDPMid, *candidate.SDPMLineIndex)
+			}
+		}
+	}
+
+	parsed, err := ice.UnmarshalCandidate(strings.TrimPrefix(candidate.Candidate, "candidate:"))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCandidateRejected, err)
+	}
+
+	if err = filter.check(parsed); err != nil {
+		return fmt.Errorf("%w: %w", ErrCandidateRejected, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package xconnwebrtc_test
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+const (
+	hostCandidate    = "candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host"
+	privateCandidate = "candidate:1 1 udp 2130706431 192.168.1.10 50000 typ host"
+	ipv6Candidate    = "candidate:1 1 udp 2130706431 2001:db8::1 50000 typ host"
+	mdnsCandidate    = "candidate:1 1 udp 2130706431 4b6f5e8c-1f2a-4c3d-9e8f-0a1b2c3d4e5f.local 50000 typ host"
+	srflxCandidate   = "candidate:2 1 udp 1694498815 203.0.113.5 40000 typ srflx raddr 0.0.0.0 rport 0"
+	relayCandidate   = "candidate:3 1 udp 16777215 198.51.100.7 3478 typ relay raddr 0.0.0.0 rport 0"
+)
+
+// newRemoteDescription returns an offer with a single data channel media
+// section, whose mid is "0".
+func newRemoteDescription(t *testing.T) *webrtc.SessionDescription {
+	connection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = connection.Close() })
+
+	_, err = connection.CreateDataChannel("data", nil)
+	require.NoError(t, err)
+	offer, err := connection.CreateOffer(nil)
+	require.NoError(t, err)
+	return &offer
+}
+
+func TestValidateRemoteCandidate(t *testing.T) {
+	remote := newRemoteDescription(t)
+	index := func(i uint16) *uint16 { return &i }
+	mid := func(m string) *string { return &m }
+	relayOnly := xconnwebrtc.CandidateFilter{Types: []webrtc.ICECandidateType{webrtc.ICECandidateTypeRelay}}
+	noHost := xconnwebrtc.CandidateFilter{Types: []webrtc.ICECandidateType{
+		webrtc.ICECandidateTypeSrflx, webrtc.ICECandidateTypePrflx, webrtc.ICECandidateTypeRelay,
+	}}
+	strict := relayOnly
+	strict.DisableIPv4, strict.DisableIPv6, strict.RejectPrivate = true, true, true
+
+	tests := []struct {
+		name      string
+		remote    *webrtc.SessionDescription
+		filter    xconnwebrtc.CandidateFilter
+		candidate webrtc.ICECandidateInit
+		rejected  bool
+	}{
+		{"Host", nil, xconnwebrtc.CandidateFilter{}, webrtc.ICECandidateInit{Candidate: hostCandidate}, false},
+		{"MatchingMid", remote, xconnwebrtc.CandidateFilter{},
+			webrtc.ICECandidateInit{Candidate: hostCandidate, SDPMid: mid("0"), SDPMLineIndex: index(0)}, false},
+
+		{"Malformed", nil, xconnwebrtc.CandidateFilter{},
+			webrtc.ICECandidateInit{Candidate: "candidate:garbage"}, true},
+		{"MalformedPort", nil, xconnwebrtc.CandidateFilter{},
+			webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.0.2.1 port typ host"}, true},
+		{"UnknownMid", remote, xconnwebrtc.CandidateFilter{},
+			webrtc.ICECandidateInit{Candidate: hostCandidate, SDPMid: mid("1")}, true},
+		{"LineIndexOutOfRange", remote, xconnwebrtc.CandidateFilter{},
+			webrtc.ICECandidateInit{Candidate: hostCandidate, SDPMLineIndex: index(1)}, true},
+
+		{"RelayOnlyRejectsHost", nil, relayOnly, webrtc.ICECandidateInit{Candidate: hostCandidate}, true},
+		{"RelayOnlyRejectsSrflx", nil, relayOnly, webrtc.ICECandidateInit{Candidate: srflxCandidate}, true},
+		{"RelayOnlyAcceptsRelay", nil, relayOnly, webrtc.ICECandidateInit{Candidate: relayCandidate}, false},
+		{"NoHostRejectsHost", nil, noHost, webrtc.ICECandidateInit{Candidate: hostCandidate}, true},
+		{"NoHostAcceptsSrflx", nil, noHost, webrtc.ICECandidateInit{Candidate: srflxCandidate}, false},
+
+		{"MDNS", nil, xconnwebrtc.CandidateFilter{}, webrtc.ICECandidateInit{Candidate: mdnsCandidate}, false},
+		{"MDNSPrivate", nil, xconnwebrtc.CandidateFilter{RejectPrivate: true},
+			webrtc.ICECandidateInit{Candidate: mdnsCandidate}, true},
+
+		{"DisableIPv4", nil, xconnwebrtc.CandidateFilter{DisableIPv4: true},
+			webrtc.ICECandidateInit{Candidate: hostCandidate}, true},
+		{"DisableIPv6", nil, xconnwebrtc.CandidateFilter{DisableIPv6: true},
+			webrtc.ICECandidateInit{Candidate: ipv6Candidate}, true},
+		{"DisableIPv6AcceptsIPv4", nil, xconnwebrtc.CandidateFilter{DisableIPv6: true},
+			webrtc.ICECandidateInit{Candidate: hostCandidate}, false},
+		{"RejectPrivate", nil, xconnwebrtc.CandidateFilter{RejectPrivate: true},
+			webrtc.ICECandidateInit{Candidate: privateCandidate}, true},
+		{"RejectPrivateAcceptsPublic", nil, xconnwebrtc.CandidateFilter{RejectPrivate: true},
+			webrtc.ICECandidateInit{Candidate: hostCandidate}, false},
+
+		{"EndOfCandidates", remote, strict, webrtc.ICECandidateInit{}, false},
+		{"EndOfCandidatesPrefixed", remote, strict,
+			webrtc.ICECandidateInit{Candidate: "candidate:", SDPMid: mid("1")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := xconnwebrtc.ValidateRemoteCandidate(tt.remote, tt.filter, tt.candidate)
+			if tt.rejected {
+				require.ErrorIs(t, err, xconnwebrtc.ErrCandidateRejected)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
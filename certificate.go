@@ -0,0 +1,233 @@
+package xconnwebrtc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/xconn-go"
+)
+
+const (
+	// certificateValidity is how long a generated certificate is valid. A
+	// persisted certificate pins the provider's fingerprint, so it must
+	// outlive the provider rather than expire after pion's default month.
+	certificateValidity = 10 * 365 * 24 * time.Hour
+	// certificateExpiryMargin is how long before its expiry
+	// LoadOrCreateCertificate refuses a certificate.
+	certificateExpiryMargin = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrFingerprintMismatch is returned when the remote peer's DTLS certificate
+	// fingerprint is not one of the pinned fingerprints.
+	ErrFingerprintMismatch = errors.New("remote DTLS fingerprint does not match any pinned fingerprint")
+	// ErrCertificateExpired is returned by LoadOrCreateCertificate for a
+	// certificate that has expired or is about to.
+	ErrCertificateExpired = errors.New("DTLS certificate expired")
+)
+
+// LoadCertificate reads a DTLS certificate and its private key from the PEM
+// file at path, as written by SaveCertificate.
+func LoadCertificate(path string) (*webrtc.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := webrtc.CertificateFromPEM(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	return certificate, nil
+}
+
+// SaveCertificate writes certificate and its private key as PEM to path,
+// readable by the owner only.
+func SaveCertificate(path string, certificate *webrtc.Certificate) error {
+	pem, err := certificate.PEM()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(pem), 0o600)
+}
+
+// LoadOrCreateCertificate loads the certificate at path, or generates a new
+// ECDSA P-256 certificate and saves it there if the file does not exist, so
+// a provider keeps the same DTLS fingerprint across restarts. A certificate
+// that expired or expires within a week is an error rather than silently
+// replaced, since replacing it changes the fingerprint clients pinned.
+func LoadOrCreateCertificate(path string) (*webrtc.Certificate, error) {
+	certificate, err := LoadCertificate(path)
+	if err == nil {
+		if expires := certificate.Expires(); time.Until(expires) < certificateExpiryMargin {
+			return nil, fmt.Errorf("%w: %s expires %s, remove it to generate a new one",
+				ErrCertificateExpired, path, expires.Format(time.RFC3339))
+		}
+		return certificate, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	certificate, err = generateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if err = SaveCertificate(path, certificate); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+func generateCertificate() (*webrtc.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return webrtc.NewCertificate(key, x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "xconn-webrtc"},
+		Issuer:       pkix.Name{CommonName: "xconn-webrtc"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+		Version:      2,
+	})
+}
+
+// FetchFingerprints calls a provider's fingerprint procedure (see
+// ProviderConfig.ProcedureFingerprint) and returns the fingerprints of its
+// DTLS certificate, e.g. to pin them on first use.
+func FetchFingerprints(session *xconn.Session, procedure string) ([]webrtc.DTLSFingerprint, error) {
+	response := session.Call(procedure).Do()
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	text, err := response.ArgString(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprints []webrtc.DTLSFingerprint
+	if err = json.Unmarshal([]byte(text), &fingerprints); err != nil {
+		return nil, err
+	}
+	return fingerprints, nil
+}
+
+// certificateFingerprints returns certificate's fingerprints as the JSON
+// array served by ProviderConfig.ProcedureFingerprint.
+func certificateFingerprints(certificate *webrtc.Certificate) (string, error) {
+	fingerprint, err := sha256Fingerprint(*certificate)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal([]webrtc.DTLSFingerprint{fingerprint})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sha256Fingerprint returns certificate's SHA-256 fingerprint as pion
+// reports it: lowercase hex bytes separated by colons.
+func sha256Fingerprint(certificate webrtc.Certificate) (webrtc.DTLSFingerprint, error) {
+	fingerprints, err := certificate.GetFingerprints()
+	if err != nil {
+		return webrtc.DTLSFingerprint{}, err
+	}
+
+	for _, fingerprint := range fingerprints {
+		if fingerprint.Algorithm == "sha-256" {
+			return fingerprint, nil
+		}
+	}
+	return webrtc.DTLSFingerprint{}, fmt.Errorf("certificate has no sha-256 fingerprint")
+}
+
+// derFingerprint returns the SHA-256 fingerprint value of a DER certificate,
+// or "" if there is none or it can't be parsed.
+func derFingerprint(der []byte) string {
+	if len(der) == 0 {
+		return ""
+	}
+
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return ""
+	}
+	fingerprint, err := sha256Fingerprint(webrtc.CertificateFromX509(nil, parsed))
+	if err != nil {
+		return ""
+	}
+	return fingerprint.Value
+}
+
+// sdpFingerprints returns every a=fingerprint attribute in sdp, session or
+// media level.
+func sdpFingerprints(sdp string) []webrtc.DTLSFingerprint {
+	var fingerprints []webrtc.DTLSFingerprint
+	for _, line := range strings.Split(sdp, "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "a=fingerprint:")
+		if !ok {
+			continue
+		}
+
+		algorithm, hash, ok := strings.Cut(value, " ")
+		if !ok {
+			continue
+		}
+		fingerprints = append(fingerprints, webrtc.DTLSFingerprint{
+			Algorithm: algorithm,
+			Value:     strings.TrimSpace(hash),
+		})
+	}
+	return fingerprints
+}
+
+// checkPinnedFingerprints verifies that every fingerprint description offers
+// for the remote DTLS certificate is pinned. The DTLS handshake then rejects
+// any certificate that doesn't match the description, so a signaling router
+// can't substitute its own.
+func checkPinnedFingerprints(description webrtc.SessionDescription, pinned []webrtc.DTLSFingerprint) error {
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	remote := sdpFingerprints(description.SDP)
+	if len(remote) == 0 {
+		return fmt.Errorf("%w: remote description has no fingerprint", ErrFingerprintMismatch)
+	}
+
+	for _, fingerprint := range remote {
+		if !slices.ContainsFunc(pinned, func(pin webrtc.DTLSFingerprint) bool {
+			return strings.EqualFold(pin.Algorithm, fingerprint.Algorithm) &&
+				strings.EqualFold(pin.Value, fingerprint.Value)
+		}) {
+			return fmt.Errorf("%w: %s %s", ErrFingerprintMismatch, fingerprint.Algorithm, fingerprint.Value)
+		}
+	}
+	return nil
+}
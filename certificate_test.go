@@ -0,0 +1,54 @@
+package xconnwebrtc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dtls.pem")
+
+	created, err := xconnwebrtc.LoadOrCreateCertificate(path)
+	require.NoError(t, err)
+
+	loaded, err := xconnwebrtc.LoadOrCreateCertificate(path)
+	require.NoError(t, err)
+	require.True(t, created.Equals(*loaded))
+
+	createdFingerprints, err := created.GetFingerprints()
+	require.NoError(t, err)
+	loadedFingerprints, err := loaded.GetFingerprints()
+	require.NoError(t, err)
+	require.Equal(t, createdFingerprints, loadedFingerprints)
+	require.True(t, created.Expires().After(time.Now().AddDate(5, 0, 0)))
+	require.Equal(t, created.Expires(), loaded.Expires())
+
+	t.Run("Expired", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		expired, err := webrtc.NewCertificate(key, x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			NotBefore:    time.Now().AddDate(0, -2, 0),
+			NotAfter:     time.Now().AddDate(0, 0, 1),
+		})
+		require.NoError(t, err)
+
+		expiredPath := filepath.Join(t.TempDir(), "expired.pem")
+		require.NoError(t, xconnwebrtc.SaveCertificate(expiredPath, expired))
+
+		_, err = xconnwebrtc.LoadOrCreateCertificate(expiredPath)
+		require.ErrorIs(t, err, xconnwebrtc.ErrCertificateExpired)
+	})
+}
@@ -1,15 +1,18 @@
 package xconnwebrtc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/transports"
 	"github.com/xconnio/xconn-go"
 )
 
@@ -28,6 +31,51 @@ type ClientConfig struct {
 	Authenticator            auth.ClientAuthenticator
 	Session                  *xconn.Session
 	ICEServers               []webrtc.ICEServer
+	ICEPolicy                ICEPolicy
+	TrickleMode              TrickleMode
+	TrickleCutoff            time.Duration
+	RemoteCandidateFilter    CandidateFilter
+	// CandidateDelivery selects how the provider sends its trickled candidates
+	// back; see CandidateDeliveryPerRequest and CandidateDeliveryEligible to
+	// stop receiving every other client's candidates.
+	CandidateDelivery CandidateDelivery
+	// InheritIdentity joins with the one-time identity ticket the provider
+	// issues when running with ProviderConfig.InheritIdentity, instead of
+	// Authenticator, so the WebRTC session carries this signaling session's
+	// identity.
+	InheritIdentity bool
+	// PinnedFingerprints, if set, are the only DTLS certificate fingerprints
+	// the provider may answer with (see FetchFingerprints); any other answer
+	// fails with ErrFingerprintMismatch before connecting.
+	PinnedFingerprints []webrtc.DTLSFingerprint
+	// Encryption, if set, encrypts the WAMP session up to a provider using
+	// ProviderConfig.Encryption; see EncryptionConfig.
+	Encryption *EncryptionConfig
+	// FallbackSerializers are tried in order when the provider rejects
+	// Serializer (and each earlier fallback) as unsupported.
+	FallbackSerializers []xconn.SerializerSpec
+	// SettingEngine is passed on to OfferConfig.SettingEngine.
+	SettingEngine func(settings *webrtc.SettingEngine)
+	// OnPeerConnection is passed on to OfferConfig.OnPeerConnection.
+	OnPeerConnection func(connection *webrtc.PeerConnection)
+	// OnEvent, if set, receives every ConnectionEvent of the connection, from
+	// EventOfferSent to EventConnectionClosed, including those of sessions
+	// opened later via WebRTCSession.OpenSession. It is called synchronously
+	// and must not block.
+	OnEvent func(event ConnectionEvent)
+	// Logger receives the connection's logs, with its request ID as an
+	// attribute once known, and pion's own logs of the PeerConnection. It is
+	// inherited by sessions opened via WebRTCSession.OpenSession. nil logs to
+	// slog.Default() and leaves pion on its default logger.
+	Logger *slog.Logger
+	// Tracer, if set, traces the connection setup under a SpanConnect span
+	// and passes the trace context on to the provider in the offer; see the
+	// Span constants. It is inherited by sessions opened via
+	// WebRTCSession.OpenSession.
+	Tracer Tracer
+	// Keepalive, if set, pings the provider over the session's DataChannel
+	// and closes the session when it stops answering; see KeepaliveConfig.
+	Keepalive *KeepaliveConfig
 
 	OnDisconnect func()
 }
@@ -60,17 +108,56 @@ func (c *ClientConfig) validate() error {
 	if c.Session == nil {
 		return fmt.Errorf("session must not be nil")
 	}
+	if err := c.ICEPolicy.validate(c.ICEServers); err != nil {
+		return err
+	}
+	if err := c.TrickleMode.validate(); err != nil {
+		return err
+	}
+	if err := c.CandidateDelivery.validate(); err != nil {
+		return err
+	}
+	if c.Encryption != nil {
+		if err := c.Encryption.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Keepalive != nil {
+		if err := c.Keepalive.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateSerializerSpecs(c.serializerSpecs()...); err != nil {
+		return err
+	}
 	return nil
 }
 
+// serializerSpecs returns the serializers to offer, in order of preference.
+func (c *ClientConfig) serializerSpecs() []xconn.SerializerSpec {
+	return append([]xconn.SerializerSpec{c.Serializer}, c.FallbackSerializers...)
+}
+
 // connectWebRTC runs the offer/answer/ICE exchange and returns the resulting
-// PeerConnection and its first (signaling) DataChannel, before any WAMP
-// handshake or join happens on it.
-func connectWebRTC(config *ClientConfig) (*webrtc.PeerConnection, *webrtc.DataChannel, error) {
+// PeerConnection, its first (signaling) DataChannel and the provider's offer
+// response, before any WAMP handshake or join happens on it. Failures are
+// *ConnectError timed from start. Its steps are traced as children of t.
+func connectWebRTC(config *ClientConfig, start time.Time, events *eventEmitter, t trace) (*webrtc.PeerConnection,
+	*webrtc.DataChannel, *OfferResponse, error) {
+
 	if err := config.validate(); err != nil {
-		return nil, nil, fmt.Errorf("invalid client config: %w", err)
+		return nil, nil, nil, fmt.Errorf("invalid client config: %w", err)
 	}
 	offerer := NewOfferer()
+	spans := &transportSpans{trace: t}
+	fail := func(phase ConnectPhase, err error) (*webrtc.PeerConnection, *webrtc.DataChannel, *OfferResponse, error) {
+		connectErr := newConnectError(phase, start, offerer.connection, err)
+		spans.fail(connectErr)
+		if offerer.connection != nil {
+			_ = offerer.connection.Close()
+		}
+		return nil, nil, nil, connectErr
+	}
 	var (
 		mu                sync.Mutex
 		requestID         string
@@ -80,29 +167,57 @@ func connectWebRTC(config *ClientConfig) (*webrtc.PeerConnection, *webrtc.DataCh
 		ICEServers:               cloneICEServers(config.ICEServers),
 		Ordered:                  true,
 		TopicAnswererOnCandidate: config.TopicAnswererOnCandidate,
+		ICEPolicy:                config.ICEPolicy,
+		TrickleMode:              config.TrickleMode,
+		TrickleCutoff:            config.TrickleCutoff,
+		RemoteCandidateFilter:    config.RemoteCandidateFilter,
+		CandidateDelivery:        config.CandidateDelivery,
+		SettingEngine:            config.SettingEngine,
+		OnPeerConnection:         config.OnPeerConnection,
+		OnEvent: func(event ConnectionEvent) {
+			events.emit(event)
+			spans.onEvent(event)
+		},
+		Logger: config.Logger,
 	}
+	if config.Keepalive != nil {
+		offerConfig.Protocol = keepaliveProtocol
+	}
+	logger := loggerOrDefault(config.Logger)
+
+	switch config.CandidateDelivery {
+	case CandidateDeliveryPerRequest:
+		// The request ID must be known before the call so the per-request
+		// topic can be subscribed to before the provider starts publishing.
+		offerConfig.RequestID = uuid.New().String()
+	case CandidateDeliveryEligible:
+		offerConfig.SessionID = config.Session.ID()
+	default:
+	}
+	events.setRequestID(offerConfig.RequestID)
 
-	subscribeResponse := config.Session.Subscribe(config.TopicOffererOnCandidate, func(event *xconn.Event) {
+	topic := candidateTopic(config.TopicOffererOnCandidate, config.CandidateDelivery, offerConfig.RequestID)
+	subscribeResponse := config.Session.Subscribe(topic, func(event *xconn.Event) {
 		if len(event.Args()) < 2 {
-			log.Debugf("invalid arguments length")
+			logger.Debug("invalid arguments length")
 			return
 		}
 
 		candidateRequestID, err := event.ArgString(0)
 		if err != nil {
-			log.Debugln("request ID must be a string")
+			logger.Debug("request ID must be a string")
 			return
 		}
 
 		candidateJSON, err := event.ArgString(1)
 		if err != nil {
-			log.Debugln("offer must be a string")
+			logger.Debug("candidate must be a string")
 			return
 		}
 
 		var candidate webrtc.ICECandidateInit
 		if err := json.Unmarshal([]byte(candidateJSON), &candidate); err != nil {
-			log.Debugln(err)
+			logger.Debug("invalid candidate", "error", err)
 			return
 		}
 
@@ -119,49 +234,77 @@ func connectWebRTC(config *ClientConfig) (*webrtc.PeerConnection, *webrtc.DataCh
 		mu.Unlock()
 
 		if !match {
-			log.Debugf("invalid requestID")
+			logger.Debug("invalid requestID", logKeyRequestID, candidateRequestID)
 			return
 		}
 
 		if err = offerer.AddICECandidate(candidate); err != nil {
-			log.Debugln(err)
+			logger.Debug("failed to add remote candidate", logKeyRequestID, candidateRequestID, "error", err)
 		}
 	}).Do()
 	if subscribeResponse.Err != nil {
-		return nil, nil, subscribeResponse.Err
+		return fail(PhaseSignaling, subscribeResponse.Err)
 	}
 	defer func() {
 		if err := subscribeResponse.Unsubscribe(); err != nil {
-			log.Debugf("failed to unsubscribe from offerer candidates: %v", err)
+			logger.Debug("failed to unsubscribe from offerer candidates", "error", err)
 		}
 	}()
 
+	_, offerSpan := t.start(SpanOfferCreate)
 	offer, err := offerer.Offer(offerConfig)
+	endSpan(offerSpan, err)
 	if err != nil {
-		return nil, nil, err
+		return fail(PhaseSignaling, err)
 	}
 
+	// The provider continues the trace from the call's span.
+	callTrace, callSpan := t.start(SpanSignalingCall)
+	offer.TraceContext = callTrace.carrier()
 	offerJSON, err := json.Marshal(offer)
 	if err != nil {
-		return nil, nil, err
+		endSpan(callSpan, err)
+		return fail(PhaseSignaling, err)
 	}
 
+	events.emit(ConnectionEvent{Type: EventOfferSent})
 	callResponse := config.Session.Call(config.ProcedureWebRTCOffer).Args(string(offerJSON)).Do()
+	endSpan(callSpan, callResponse.Err)
 	if callResponse.Err != nil {
-		return nil, nil, callResponse.Err
+		return fail(PhaseSignaling, callResponse.Err)
 	}
 
 	offerResponseText, err := callResponse.ArgString(0)
 	if err != nil {
-		return nil, nil, err
+		return fail(PhaseSignaling, err)
 	}
 	var offerResponse OfferResponse
 	if err = json.Unmarshal([]byte(offerResponseText), &offerResponse); err != nil {
-		return nil, nil, err
+		return fail(PhaseSignaling, err)
 	}
 	if offerResponse.RequestID == "" {
-		return nil, nil, fmt.Errorf("offer response request ID must not be empty")
+		return fail(PhaseSignaling, fmt.Errorf("offer response request ID must not be empty"))
+	}
+	if offerConfig.RequestID != "" && offerResponse.RequestID != offerConfig.RequestID {
+		return fail(PhaseSignaling, fmt.Errorf("offer response request ID %q does not match offered %q",
+			offerResponse.RequestID, offerConfig.RequestID))
+	}
+
+	if err = checkPinnedFingerprints(offerResponse.Answer.Description, config.PinnedFingerprints); err != nil {
+		return fail(PhaseDTLS, err)
+	}
+
+	// The answer must be applied before any trickled candidate: validating
+	// and adding them both need the remote description.
+	events.setRequestID(offerResponse.RequestID)
+	spans.startICE()
+	_, answerSpan := t.start(SpanAnswerApply)
+	err = offerer.HandleAnswer(offerResponse.Answer)
+	endSpan(answerSpan, err)
+	if err != nil {
+		return fail(PhaseSignaling, err)
 	}
+	events.emit(ConnectionEvent{Type: EventAnswerReceived})
 
 	mu.Lock()
 	requestID = offerResponse.RequestID
@@ -174,25 +317,18 @@ func connectWebRTC(config *ClientConfig) (*webrtc.PeerConnection, *webrtc.DataCh
 			continue
 		}
 		if err = offerer.AddICECandidate(pc.candidate); err != nil {
-			log.Debugln(err)
+			logger.Debug("failed to add remote candidate", logKeyRequestID, requestID, "error", err)
 		}
 	}
 
 	offerer.StartICETrickle(config.Session, offerConfig.TopicAnswererOnCandidate, requestID)
 
-	if err = offerer.HandleAnswer(offerResponse.Answer); err != nil {
-		return nil, nil, err
-	}
-
 	channel, err := waitForDataChannel(offerer.connection, offerer.WaitReady(), config.ConnectTimeout)
 	if err != nil {
-		if offerer.connection != nil {
-			_ = offerer.connection.Close()
-		}
-		return nil, nil, err
+		return fail(transportPhase(offerer.connection), err)
 	}
 
-	return offerer.connection, channel, nil
+	return offerer.connection, channel, &offerResponse, nil
 }
 
 func waitForDataChannel(connection *webrtc.PeerConnection, ready <-chan *webrtc.DataChannel,
@@ -203,17 +339,17 @@ func waitForDataChannel(connection *webrtc.PeerConnection, ready <-chan *webrtc.
 			switch state {
 			case webrtc.PeerConnectionStateFailed:
 				select {
-				case errCh <- fmt.Errorf("webrtc connection failed before data channel opened"):
+				case errCh <- fmt.Errorf("%w before data channel opened", ErrConnectionFailed):
 				default:
 				}
 			case webrtc.PeerConnectionStateDisconnected:
 				select {
-				case errCh <- fmt.Errorf("webrtc connection disconnected before data channel opened"):
+				case errCh <- fmt.Errorf("%w: disconnected before data channel opened", ErrConnectionFailed):
 				default:
 				}
 			case webrtc.PeerConnectionStateClosed:
 				select {
-				case errCh <- fmt.Errorf("webrtc connection closed before data channel opened"):
+				case errCh <- fmt.Errorf("%w before data channel opened", ErrConnectionClosed):
 				default:
 				}
 			default:
@@ -233,7 +369,7 @@ func waitForDataChannel(connection *webrtc.PeerConnection, ready <-chan *webrtc.
 	case err := <-errCh:
 		return nil, err
 	case <-timer.C:
-		return nil, fmt.Errorf("webrtc connection timed out after %s waiting for data channel", timeout)
+		return nil, fmt.Errorf("%w after %s waiting for data channel", ErrTimeout, timeout)
 	}
 }
 
@@ -242,14 +378,56 @@ func waitForDataChannel(connection *webrtc.PeerConnection, ready <-chan *webrtc.
 // *xconn.Session, the result is immediately usable for WAMP calls, and also
 // exposes the underlying connection for opening more sessions or raw data
 // channels (see WebRTCSession.OpenSession / OpenChannel / OnDataChannel).
+// Apart from an invalid config, failures are a *ConnectError naming the phase
+// that failed.
 func ConnectWAMP(config *ClientConfig) (*WebRTCSession, error) {
-	connection, channel, err := connectWebRTC(config)
+	start := time.Now()
+	var onEvent func(event ConnectionEvent)
+	var tracer Tracer
+	if config != nil {
+		onEvent, tracer = config.OnEvent, config.Tracer
+	}
+	events := newEventEmitter(onEvent, "")
+	t, span := newTrace(context.Background(), tracer).start(SpanConnect)
+	session, err := connectWAMP(config, start, events, t, span)
+	endSpan(span, err)
+	return session, err
+}
+
+// connectWAMP is ConnectWAMP, traced under span.
+func connectWAMP(config *ClientConfig, start time.Time, events *eventEmitter, t trace,
+	span Span) (*WebRTCSession, error) {
+
+	connection, channel, offerResponse, err := connectWebRTC(config, start, events, t)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttribute(logKeyRequestID, offerResponse.RequestID)
 
-	session, err := joinWebRTCSession(connection, channel, config.Realm,
-		config.Serializer, config.Authenticator, config.ConnectTimeout)
+	authenticator := config.Authenticator
+	if config.InheritIdentity {
+		if offerResponse.Ticket == "" {
+			err = newConnectError(PhaseSignaling, start, connection,
+				fmt.Errorf("provider did not issue an identity ticket"))
+			_ = connection.Close()
+			return nil, err
+		}
+		authenticator = auth.NewTicketAuthenticator(offerResponse.AuthID, offerResponse.Ticket, nil)
+	}
+
+	logger := withRequestID(loggerOrDefault(config.Logger), offerResponse.RequestID)
+	session, err := joinWebRTCSession(connection, channel, &joinOptions{
+		realm:         config.Realm,
+		specs:         config.serializerSpecs(),
+		authenticator: authenticator,
+		encryption:    config.Encryption,
+		keepalive:     config.Keepalive,
+		start:         start,
+		timeout:       config.ConnectTimeout,
+		events:        events,
+		logger:        logger,
+		trace:         t,
+	})
 	if err != nil {
 		if connection != nil {
 			_ = connection.Close()
@@ -257,6 +435,8 @@ func ConnectWAMP(config *ClientConfig) (*WebRTCSession, error) {
 		return nil, err
 	}
 
+	newSessionGroup(session)
+
 	// Closing this session's own channel (handled inside joinWebRTCSession)
 	// already covers connection failure, since pion cascades the failure to
 	// every channel's own read loop. This handler only needs to surface the
@@ -264,6 +444,9 @@ func ConnectWAMP(config *ClientConfig) (*WebRTCSession, error) {
 	connection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		switch state {
 		case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			if state != webrtc.PeerConnectionStateDisconnected {
+				events.emit(ConnectionEvent{Type: EventConnectionClosed, PeerState: state})
+			}
 			if config.OnDisconnect != nil {
 				config.OnDisconnect()
 			}
@@ -274,30 +457,82 @@ func ConnectWAMP(config *ClientConfig) (*WebRTCSession, error) {
 	return session, nil
 }
 
+// joinOptions configure joinWebRTCSession.
+type joinOptions struct {
+	realm string
+	// specs are the serializers to offer, in order of preference.
+	specs         []xconn.SerializerSpec
+	authenticator auth.ClientAuthenticator
+	encryption    *EncryptionConfig
+	keepalive     *KeepaliveConfig
+	// start times ConnectErrors; timeout bounds the handshake.
+	start   time.Time
+	timeout time.Duration
+	// events receives the session's handshake, join and close events,
+	// logger its logs, and trace the spans of the handshake and join.
+	events *eventEmitter
+	logger *slog.Logger
+	trace  trace
+}
+
 // joinWebRTCSession performs the magic-byte handshake and WAMP join over an
 // already-open channel, wrapping the result in a WebRTCSession that shares
 // connection. Used both for a brand new PeerConnection's first channel and
 // for additional channels opened via WebRTCSession.OpenSession.
-func joinWebRTCSession(connection *webrtc.PeerConnection, channel *webrtc.DataChannel, realm string,
-	spec xconn.SerializerSpec, authenticator auth.ClientAuthenticator, timeout time.Duration) (*WebRTCSession, error) {
-
-	if err := sendClientHandshake(channel, spec, timeout); err != nil {
+func joinWebRTCSession(connection *webrtc.PeerConnection, channel *webrtc.DataChannel,
+	options *joinOptions) (*WebRTCSession, error) {
+
+	start, timeout := options.start, options.timeout
+	events, logger, t := options.events, options.logger, options.trace
+
+	_, handshakeSpan := t.start(SpanHandshake)
+	handshakeSpan.SetAttribute(logKeyLabel, channel.Label())
+	spec, keepalive, err := sendClientHandshake(channel, options.specs, timeout, logger)
+	var cipher *e2eCipher
+	if err == nil && options.encryption != nil {
+		cipher, err = exchangeClientKeys(channel, options.encryption, transports.Serializer(spec.SerializerID()),
+			timeout)
+	}
+	if err != nil {
+		err = newConnectError(PhaseHandshake, start, connection, err)
+		endSpan(handshakeSpan, err)
 		return nil, err
 	}
+	handshakeSpan.End()
 
-	peer := NewWebRTCPeer(channel)
-	base, err := xconn.Join(peer, realm, spec.Serializer(), authenticator)
+	events.emit(ConnectionEvent{Type: EventHandshakeDone, Label: channel.Label()})
+
+	_, joinSpan := t.start(SpanJoin)
+	peer := newWebRTCPeer(channel, cipher, logger)
+	base, err := xconn.Join(peer, options.realm, spec.Serializer(), options.authenticator)
 	if err != nil {
+		err = newConnectError(PhaseJoin, start, connection, err)
+		endSpan(joinSpan, err)
 		return nil, err
 	}
+	joinSpan.SetAttribute(logKeySessionID, base.ID())
+	joinSpan.End()
+	events.emit(ConnectionEvent{Type: EventJoined, Label: channel.Label(), SessionID: base.ID()})
+	// The remote only answers pings once its own peer exists, which a
+	// completed join guarantees.
+	if keepalive {
+		peer.startKeepalive(options.keepalive)
+	} else if options.keepalive != nil {
+		logger.Debug("remote doesn't support keepalive", logKeyLabel, channel.Label())
+	}
 
 	channel.OnClose(func() {
 		_ = base.Close()
+		events.emit(ConnectionEvent{Type: EventSessionClosed, Label: channel.Label(), SessionID: base.ID()})
 	})
 
 	return &WebRTCSession{
 		Session:    xconn.NewSession(base, spec.Serializer()),
 		connection: connection,
 		channel:    channel,
+		peer:       peer,
+		events:     events,
+		logger:     logger,
+		tracer:     t.tracer,
 	}, nil
 }
@@ -0,0 +1,92 @@
+package xconnwebrtc_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// rejectingAuthenticator admits no one.
+type rejectingAuthenticator struct{}
+
+func (rejectingAuthenticator) Methods() []auth.Method {
+	return []auth.Method{auth.MethodAnonymous}
+}
+
+func (rejectingAuthenticator) Authenticate(auth.Request) (auth.Response, error) {
+	return nil, fmt.Errorf("not allowed")
+}
+
+// requireConnectError asserts err is a ConnectError of phase.
+func requireConnectError(t *testing.T, err error, phase xconnwebrtc.ConnectPhase) *xconnwebrtc.ConnectError {
+	var connectErr *xconnwebrtc.ConnectError
+	require.True(t, errors.As(err, &connectErr), "not a ConnectError: %v", err)
+	require.Equal(t, phase, connectErr.Phase, err.Error())
+	return connectErr
+}
+
+func TestConnectWAMP(t *testing.T) {
+	_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+
+	session, err := xconnwebrtc.ConnectWAMP(config)
+	require.NoError(t, err)
+	require.NoError(t, session.Close())
+}
+
+func TestConnectWAMPFailure(t *testing.T) {
+	t.Run("HandshakeRejected", func(t *testing.T) {
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{
+			Serializers: []transports.Serializer{transports.SerializerCbor},
+		})
+		config.Serializer = xconn.JSONSerializerSpec
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		requireConnectError(t, err, xconnwebrtc.PhaseHandshake)
+		require.ErrorIs(t, err, xconnwebrtc.ErrHandshakeFailed)
+		require.ErrorIs(t, err, xconnwebrtc.ErrSerializerUnsupported)
+	})
+
+	t.Run("JoinRejected", func(t *testing.T) {
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{Authenticator: rejectingAuthenticator{}})
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		connectErr := requireConnectError(t, err, xconnwebrtc.PhaseJoin)
+		require.ErrorIs(t, err, xconnwebrtc.ErrJoinFailed)
+		require.Equal(t, webrtc.PeerConnectionStateConnected, connectErr.PeerState)
+	})
+
+	t.Run("ICETimeout", func(t *testing.T) {
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+		// Without a single local candidate, ICE never finds a pair.
+		config.SettingEngine = func(settings *webrtc.SettingEngine) {
+			settings.SetIPFilter(func(net.IP) bool { return false })
+		}
+		config.ConnectTimeout = time.Second
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		requireConnectError(t, err, xconnwebrtc.PhaseICE)
+		require.ErrorIs(t, err, xconnwebrtc.ErrICEFailed)
+		require.ErrorIs(t, err, xconnwebrtc.ErrTimeout)
+	})
+
+	t.Run("NoIdentityTicket", func(t *testing.T) {
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+		config.InheritIdentity = true
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		connectErr := requireConnectError(t, err, xconnwebrtc.PhaseSignaling)
+		require.ErrorIs(t, err, xconnwebrtc.ErrSignalingFailed)
+		// The state is the connection's before it was closed for the failure.
+		require.Equal(t, webrtc.PeerConnectionStateConnected, connectErr.PeerState)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xconnio/xconn-go"
+)
+
+// run is one benchmark run: requests calls of a size-byte payload, issued
+// by concurrency workers over one session.
+type run struct {
+	transport   string
+	size        int
+	concurrency int
+	requests    int
+}
+
+// result is the outcome of a run.
+type result struct {
+	run
+	latencies []time.Duration
+	failed    int
+	elapsed   time.Duration
+}
+
+// benchmark calls procedure with the run's payload until requests calls
+// completed, recording each round trip.
+func benchmark(session *xconn.Session, procedure string, r run) *result {
+	payload := make([]byte, r.size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	var (
+		next      atomic.Int64
+		failed    atomic.Int64
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, r.requests)
+		wg        sync.WaitGroup
+	)
+
+	start := time.Now()
+	for range r.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			local := make([]time.Duration, 0, r.requests/r.concurrency+1)
+			for next.Add(1) <= int64(r.requests) {
+				callStart := time.Now()
+				if session.Call(procedure).Arg(payload).Do().Err != nil {
+					failed.Add(1)
+					continue
+				}
+				local = append(local, time.Since(callStart))
+			}
+
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(latencies)
+	return &result{
+		run:       r,
+		latencies: latencies,
+		failed:    int(failed.Load()),
+		elapsed:   time.Since(start),
+	}
+}
+
+// percentile returns the p-th percentile of the sorted latencies.
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(p*float64(len(r.latencies)-1))]
+}
+
+func printHeader(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "%-10s %10s %5s %8s %7s %10s %10s %10s %10s %10s %10s\n",
+		"transport", "size", "conc", "calls", "failed", "p50", "p90", "p99", "max", "calls/s", "MB/s")
+}
+
+func (r *result) print(w io.Writer) {
+	seconds := r.elapsed.Seconds()
+	calls := float64(len(r.latencies))
+	// Each call carries the payload both ways.
+	megabytes := 2 * calls * float64(r.size) / 1e6
+
+	_, _ = fmt.Fprintf(w, "%-10s %10d %5d %8d %7d %10s %10s %10s %10s %10.0f %10.2f\n",
+		r.transport, r.size, r.concurrency, len(r.latencies), r.failed,
+		round(r.percentile(0.5)), round(r.percentile(0.9)), round(r.percentile(0.99)), round(r.percentile(1)),
+		calls/seconds, megabytes/seconds)
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
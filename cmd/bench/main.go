@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+const (
+	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
+	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
+	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+	procedureEcho            = "io.xconn.webrtc.bench.echo"
+
+	loopbackRealm = "bench"
+	warmupCalls   = 10
+)
+
+// options are the command line flags.
+type options struct {
+	url         string
+	realm       string
+	authID      string
+	ticket      string
+	serializer  string
+	iceServers  string
+	sizes       []int
+	concurrency []int
+	requests    int
+	baseline    bool
+}
+
+func parseOptions() (*options, error) {
+	opts := &options{}
+	var sizes, concurrency string
+	flag.StringVar(&opts.url, "url", "",
+		"router URL of a running provider; the bench registers the echo procedure over its own WebSocket "+
+			"session there. Empty runs provider and client in-process over loopback")
+	flag.StringVar(&opts.realm, "realm", "realm1", "realm to join with -url")
+	flag.StringVar(&opts.authID, "authid", "", "authid for ticket authentication with -url")
+	flag.StringVar(&opts.ticket, "ticket", "", "ticket for ticket authentication with -url, anonymous if empty")
+	flag.StringVar(&opts.serializer, "serializer", "cbor", "json, msgpack or cbor")
+	flag.StringVar(&opts.iceServers, "ice-servers", "stun:stun.l.google.com:19302",
+		"comma separated ICE server URLs with -url")
+	flag.StringVar(&sizes, "sizes", "64,1024,16384,262144", "comma separated payload sizes in bytes")
+	flag.StringVar(&concurrency, "concurrency", "1,16", "comma separated numbers of concurrent callers")
+	flag.IntVar(&opts.requests, "requests", 1000, "calls per payload size and concurrency")
+	flag.BoolVar(&opts.baseline, "baseline", true,
+		"also benchmark a session joined without WebRTC: over WebSocket with -url, in-process otherwise")
+	flag.Parse()
+
+	var err error
+	if opts.sizes, err = parseInts(sizes); err != nil {
+		return nil, fmt.Errorf("invalid -sizes: %w", err)
+	}
+	if opts.concurrency, err = parseInts(concurrency); err != nil {
+		return nil, fmt.Errorf("invalid -concurrency: %w", err)
+	}
+	if opts.requests < 1 {
+		return nil, fmt.Errorf("-requests must be positive")
+	}
+	return opts, nil
+}
+
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if value < 1 {
+			return nil, fmt.Errorf("%d must be positive", value)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (o *options) serializerSpec() (xconn.SerializerSpec, error) {
+	switch o.serializer {
+	case "json":
+		return xconn.JSONSerializerSpec, nil
+	case "msgpack":
+		return xconn.MsgPackSerializerSpec, nil
+	case "cbor":
+		return xconn.CBORSerializerSpec, nil
+	default:
+		return nil, fmt.Errorf("unknown serializer %q", o.serializer)
+	}
+}
+
+func (o *options) authenticator() auth.ClientAuthenticator {
+	if o.ticket == "" {
+		return auth.NewAnonymousAuthenticator(o.authID, nil)
+	}
+	return auth.NewTicketAuthenticator(o.authID, o.ticket, nil)
+}
+
+// target is a session to benchmark, named after its transport.
+type target struct {
+	name    string
+	session *xconn.Session
+}
+
+// sessions are what a benchmark needs: the sessions to benchmark, the
+// WebRTC one first, and the one registering the echo procedure.
+type sessions struct {
+	targets []target
+	echo    *xconn.Session
+	close   func()
+}
+
+// loopbackOnly makes a PeerConnection gather loopback host candidates only,
+// for both ends running in-process without any network.
+func loopbackOnly(settings *webrtc.SettingEngine) {
+	settings.SetIncludeLoopbackCandidate(true)
+	settings.SetIPFilter(func(ip net.IP) bool {
+		return ip.IsLoopback()
+	})
+}
+
+// setupLoopback runs a provider in local router mode and a client in-process,
+// signaling over an in-process router and connecting over loopback ICE
+// candidates only.
+func setupLoopback(opts *options, serializer xconn.SerializerSpec) (*sessions, error) {
+	signaling, err := xconnwebrtc.NewLocalRouter("signaling")
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := xconnwebrtc.ListenPeer(&xconnwebrtc.ProviderConfig{
+		Session:                     signaling.Session(),
+		ProcedureHandleOffer:        procedureWebRTCOffer,
+		TopicHandleRemoteCandidates: topicAnswererOnCandidate,
+		TopicPublishLocalCandidate:  topicOffererOnCandidate,
+		SettingEngine:               loopbackOnly,
+		Authenticator:               xconnwebrtc.NewOpenAuthenticator(),
+	}, loopbackRealm)
+	if err != nil {
+		_ = signaling.Close()
+		return nil, err
+	}
+	local := listener.Provider().LocalRouter()
+
+	closeAll := func() {
+		_ = listener.Close()
+		_ = signaling.Close()
+	}
+
+	clientSignaling, err := signaling.Join()
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	webRTC, err := xconnwebrtc.ConnectWAMP(&xconnwebrtc.ClientConfig{
+		Realm:                    loopbackRealm,
+		ProcedureWebRTCOffer:     procedureWebRTCOffer,
+		TopicAnswererOnCandidate: topicAnswererOnCandidate,
+		TopicOffererOnCandidate:  topicOffererOnCandidate,
+		Serializer:               serializer,
+		Session:                  clientSignaling,
+		SettingEngine:            loopbackOnly,
+	})
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	s := &sessions{
+		targets: []target{{"webrtc", webRTC.Session}},
+		echo:    local.Session(),
+		close: func() {
+			_ = webRTC.Close()
+			closeAll()
+		},
+	}
+	if opts.baseline {
+		baseline, err := local.Join()
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.targets = append(s.targets, target{"in-process", baseline})
+	}
+	return s, nil
+}
+
+// setupRemote connects to the router of a running provider: the echo
+// procedure is registered over WebSocket and called over WebRTC.
+func setupRemote(opts *options, serializer xconn.SerializerSpec) (*sessions, error) {
+	connect := func() (*xconn.Session, error) {
+		client := xconn.Client{Authenticator: opts.authenticator(), SerializerSpec: serializer}
+		return client.Connect(context.Background(), opts.url, opts.realm)
+	}
+
+	echo, err := connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", opts.url, err)
+	}
+
+	webRTC, err := xconnwebrtc.ConnectWAMP(&xconnwebrtc.ClientConfig{
+		Realm:                    opts.realm,
+		ProcedureWebRTCOffer:     procedureWebRTCOffer,
+		TopicAnswererOnCandidate: topicAnswererOnCandidate,
+		TopicOffererOnCandidate:  topicOffererOnCandidate,
+		Serializer:               serializer,
+		Authenticator:            opts.authenticator(),
+		Session:                  echo,
+		ICEServers:               []xconnwebrtc.ICEServer{{URLs: strings.Split(opts.iceServers, ",")}},
+	})
+	if err != nil {
+		_ = echo.Leave()
+		return nil, err
+	}
+
+	s := &sessions{
+		targets: []target{{"webrtc", webRTC.Session}},
+		echo:    echo,
+		close: func() {
+			_ = webRTC.Close()
+			_ = echo.Leave()
+		},
+	}
+	if opts.baseline {
+		baseline, err := connect()
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.targets = append(s.targets, target{"websocket", baseline})
+	}
+	return s, nil
+}
+
+func main() {
+	opts, err := parseOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serializer, err := opts.serializerSpec()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	setup := setupLoopback
+	if opts.url != "" {
+		setup = setupRemote
+	}
+	s, err := setup(opts, serializer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.close()
+
+	registerResponse := s.echo.Register(procedureEcho,
+		func(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+			return xconn.NewInvocationResult(invocation.Args()...)
+		}).Do()
+	if registerResponse.Err != nil {
+		log.Fatal("Failed to register echo procedure:", registerResponse.Err)
+	}
+
+	printHeader(os.Stdout)
+	for _, size := range opts.sizes {
+		for _, concurrency := range opts.concurrency {
+			for _, t := range s.targets {
+				benchmark(t.session, procedureEcho, run{size: size, concurrency: 1, requests: warmupCalls})
+
+				result := benchmark(t.session, procedureEcho, run{
+					transport:   t.name,
+					size:        size,
+					concurrency: concurrency,
+					requests:    opts.requests,
+				})
+				result.print(os.Stdout)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// command is one of the client's subcommands, taking between minArgs and
+// maxArgs arguments (any number if maxArgs is negative).
+type command struct {
+	minArgs int
+	maxArgs int
+	run     func(session *xconnwebrtc.WebRTCSession, opts *options, args []string) error
+}
+
+var commands = map[string]command{ //nolint:gochecknoglobals
+	"connect":   {minArgs: 0, maxArgs: 0, run: runConnect},
+	"call":      {minArgs: 1, maxArgs: -1, run: runCall},
+	"publish":   {minArgs: 1, maxArgs: -1, run: runPublish},
+	"subscribe": {minArgs: 1, maxArgs: 1, run: runSubscribe},
+	"register":  {minArgs: 1, maxArgs: 1, run: runRegister},
+	"sessions":  {minArgs: 1, maxArgs: 1, run: runSessions},
+}
+
+func (c command) checkArgs(args []string) error {
+	if len(args) < c.minArgs {
+		return fmt.Errorf("expected at least %d arguments, got %d", c.minArgs, len(args))
+	}
+	if c.maxArgs >= 0 && len(args) > c.maxArgs {
+		return fmt.Errorf("expected at most %d arguments, got %d", c.maxArgs, len(args))
+	}
+	return nil
+}
+
+func runConnect(session *xconnwebrtc.WebRTCSession, _ *options, _ []string) error {
+	details := session.Details()
+	fmt.Printf("session %d joined realm %s as %s (%s)\n", session.ID(), details.Realm(), details.AuthID(),
+		details.AuthRole())
+	return nil
+}
+
+func runCall(session *xconnwebrtc.WebRTCSession, _ *options, args []string) error {
+	callResponse := session.Call(args[0]).Args(parseArgs(args[1:])...).Do()
+	if callResponse.Err != nil {
+		return callResponse.Err
+	}
+
+	printValue(callResponse.Args())
+	return nil
+}
+
+func runPublish(session *xconnwebrtc.WebRTCSession, _ *options, args []string) error {
+	return session.Publish(args[0]).Args(parseArgs(args[1:])...).Option("acknowledge", true).Do().Err
+}
+
+func runSubscribe(session *xconnwebrtc.WebRTCSession, _ *options, args []string) error {
+	subscribeResponse := session.Subscribe(args[0], func(event *xconn.Event) {
+		printValue(map[string]any{"args": event.Args(), "kwargs": event.Kwargs(), "details": event.Details()})
+	}).Do()
+	if subscribeResponse.Err != nil {
+		return subscribeResponse.Err
+	}
+
+	fmt.Printf("subscribed to %s, waiting for events\n", args[0])
+	waitForInterrupt(session)
+	return nil
+}
+
+func runRegister(session *xconnwebrtc.WebRTCSession, _ *options, args []string) error {
+	registerResponse := session.Register(args[0],
+		func(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+			printValue(map[string]any{"args": invocation.Args(), "kwargs": invocation.Kwargs()})
+			return xconn.NewInvocationResult(invocation.Args()...)
+		}).Do()
+	if registerResponse.Err != nil {
+		return registerResponse.Err
+	}
+
+	fmt.Printf("registered %s, echoing invocations\n", args[0])
+	waitForInterrupt(session)
+	return nil
+}
+
+func runSessions(session *xconnwebrtc.WebRTCSession, opts *options, args []string) error {
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		return fmt.Errorf("count must be a positive number")
+	}
+
+	serializer, err := opts.serializerSpec()
+	if err != nil {
+		return err
+	}
+
+	var opened []*xconnwebrtc.WebRTCSession
+	defer func() {
+		for _, extra := range opened {
+			_ = extra.Close()
+		}
+	}()
+
+	for i := range count {
+		authenticator, err := opts.authenticator()
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		extra, err := session.OpenSession(opts.realm, &xconnwebrtc.OpenSessionConfig{
+			Serializer:    serializer,
+			Authenticator: authenticator,
+			OpenTimeout:   opts.timeout,
+		})
+		if err != nil {
+			return fmt.Errorf("session %d: %w", i+1, err)
+		}
+		opened = append(opened, extra)
+
+		fmt.Printf("session %d opened in %s\n", extra.ID(), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// parseArgs parses each argument as JSON, keeping it as a string if it
+// isn't valid JSON.
+func parseArgs(args []string) []any {
+	parsed := make([]any, 0, len(args))
+	for _, arg := range args {
+		var value any
+		if err := json.Unmarshal([]byte(arg), &value); err != nil {
+			value = arg
+		}
+		parsed = append(parsed, value)
+	}
+	return parsed
+}
+
+// printValue prints value as JSON, or as Go syntax if it holds values JSON
+// can't represent, e.g. the non-string map keys of MsgPack and CBOR.
+func printValue(value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		fmt.Printf("%#v\n", value)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func waitForInterrupt(session *xconnwebrtc.WebRTCSession) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-session.Done():
+	}
+}
@@ -2,6 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,30 +19,176 @@ const (
 	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
 	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
 	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+
+	usage = `Usage: client [flags] [command [args...]]
+
+Connects a WAMP session over WebRTC and runs command on it:
+
+  connect                       print the session ID (default)
+  call <procedure> [args...]    call procedure and print its result
+  publish <topic> [args...]     publish to topic with acknowledgement
+  subscribe <topic>             print events on topic until interrupted
+  register <procedure>          register procedure returning its arguments
+  sessions <count>              open count more sessions on the connection
+
+Arguments are parsed as JSON, falling back to plain strings.
+
+Flags:
+`
 )
 
-func main() {
-	session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
+// options are the command line flags.
+type options struct {
+	url        string
+	realm      string
+	authMethod string
+	authID     string
+	ticket     string
+	secret     string
+	privateKey string
+	serializer string
+	iceServers []string
+	timeout    time.Duration
+	timeline   bool
+
+	procedureOffer           string
+	topicOffererOnCandidate  string
+	topicAnswererOnCandidate string
+}
+
+func parseOptions() *options {
+	opts := &options{}
+	flag.StringVar(&opts.url, "url", "ws://localhost:8080/ws", "signaling router URL")
+	flag.StringVar(&opts.realm, "realm", "realm1", "realm of both the signaling and the WebRTC session")
+	flag.StringVar(&opts.authMethod, "authmethod", "anonymous", "anonymous, ticket, wampcra or cryptosign")
+	flag.StringVar(&opts.authID, "authid", "", "authid to authenticate as")
+	flag.StringVar(&opts.ticket, "ticket", "", "ticket for -authmethod ticket")
+	flag.StringVar(&opts.secret, "secret", "", "secret for -authmethod wampcra")
+	flag.StringVar(&opts.privateKey, "private-key", "", "hex Ed25519 private key for -authmethod cryptosign")
+	flag.StringVar(&opts.serializer, "serializer", "cbor", "json, msgpack or cbor")
+	flag.Func("ice-server", "ICE server URL, repeatable (default stun:stun.l.google.com:19302)",
+		func(url string) error {
+			opts.iceServers = append(opts.iceServers, url)
+			return nil
+		})
+	flag.DurationVar(&opts.timeout, "timeout", 20*time.Second, "WebRTC connect timeout")
+	flag.BoolVar(&opts.timeline, "timeline", false,
+		"print a timeline of signaling, candidates, ICE, DTLS and join to stderr")
+	flag.StringVar(&opts.procedureOffer, "procedure-offer", procedureWebRTCOffer, "offer procedure")
+	flag.StringVar(&opts.topicOffererOnCandidate, "topic-offerer-candidate", topicOffererOnCandidate,
+		"topic the provider publishes its candidates on")
+	flag.StringVar(&opts.topicAnswererOnCandidate, "topic-answerer-candidate", topicAnswererOnCandidate,
+		"topic to publish candidates to the provider on")
+	flag.Usage = func() {
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(opts.iceServers) == 0 {
+		opts.iceServers = []string{"stun:stun.l.google.com:19302"}
+	}
+	return opts
+}
+
+func (o *options) authenticator() (auth.ClientAuthenticator, error) {
+	switch o.authMethod {
+	case "anonymous":
+		return auth.NewAnonymousAuthenticator(o.authID, nil), nil
+	case "ticket":
+		return auth.NewTicketAuthenticator(o.authID, o.ticket, nil), nil
+	case "wampcra":
+		return auth.NewWAMPCRAAuthenticator(o.authID, o.secret, nil), nil
+	case "cryptosign":
+		return auth.NewCryptoSignAuthenticator(o.authID, o.privateKey, nil)
+	default:
+		return nil, fmt.Errorf("unknown auth method %q", o.authMethod)
+	}
+}
+
+func (o *options) serializerSpec() (xconn.SerializerSpec, error) {
+	switch o.serializer {
+	case "json":
+		return xconn.JSONSerializerSpec, nil
+	case "msgpack":
+		return xconn.MsgPackSerializerSpec, nil
+	case "cbor":
+		return xconn.CBORSerializerSpec, nil
+	default:
+		return nil, fmt.Errorf("unknown serializer %q", o.serializer)
+	}
+}
+
+// connect joins the signaling router and then the WebRTC session, marking
+// each step on events.
+func connect(opts *options, events *timeline) (*xconnwebrtc.WebRTCSession, error) {
+	serializer, err := opts.serializerSpec()
+	if err != nil {
+		return nil, err
+	}
+	// Authenticators are built per session: some keep per-join state.
+	signalingAuthenticator, err := opts.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := opts.authenticator()
 	if err != nil {
-		log.Fatal("Failed to connect to server:", err)
+		return nil, err
 	}
 
+	client := xconn.Client{Authenticator: signalingAuthenticator, SerializerSpec: serializer}
+	session, err := client.Connect(context.Background(), opts.url, opts.realm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", opts.url, err)
+	}
+	events.mark("signaling session %d joined %s", session.ID(), opts.url)
+
 	config := &xconnwebrtc.ClientConfig{
-		Realm:                    "realm1",
-		ProcedureWebRTCOffer:     procedureWebRTCOffer,
-		TopicAnswererOnCandidate: topicAnswererOnCandidate,
-		TopicOffererOnCandidate:  topicOffererOnCandidate,
-		Serializer:               xconn.CBORSerializerSpec,
-		Authenticator:            auth.NewWAMPCRAAuthenticator("john", "hello", map[string]any{}),
+		Realm:                    opts.realm,
+		ProcedureWebRTCOffer:     opts.procedureOffer,
+		TopicAnswererOnCandidate: opts.topicAnswererOnCandidate,
+		TopicOffererOnCandidate:  opts.topicOffererOnCandidate,
+		ConnectTimeout:           opts.timeout,
+		Serializer:               serializer,
+		Authenticator:            authenticator,
 		Session:                  session,
-		ICEServers: []xconnwebrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
+		ICEServers:               []xconnwebrtc.ICEServer{{URLs: opts.iceServers}},
+		OnPeerConnection:         events.watch,
+		OnEvent:                  events.event,
+		OnDisconnect: func() {
+			events.mark("peer connection lost")
 		},
 	}
 	webRTCSession, err := xconnwebrtc.ConnectWAMP(config)
+	if err != nil {
+		return nil, err
+	}
+	return webRTCSession, nil
+}
+
+func main() {
+	opts := parseOptions()
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"connect"}
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := command.checkArgs(args[1:]); err != nil {
+		log.Fatalf("%s: %v", args[0], err)
+	}
+
+	session, err := connect(opts, newTimeline(opts.timeline))
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer func() { _ = session.Close() }()
 
-	log.Println(webRTCSession.ID())
+	if err = command.run(session, opts, args[1:]); err != nil {
+		log.Fatalf("%s %s: %v", args[0], strings.Join(args[1:], " "), err)
+	}
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// timeline prints connection events with their offset from the start of the
+// connection attempt.
+type timeline struct {
+	start   time.Time
+	enabled bool
+
+	sync.Mutex
+}
+
+func newTimeline(enabled bool) *timeline {
+	return &timeline{start: time.Now(), enabled: enabled}
+}
+
+func (t *timeline) mark(format string, args ...any) {
+	if !t.enabled {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	elapsed := time.Since(t.start).Round(time.Millisecond)
+	_, _ = fmt.Fprintf(os.Stderr, "%+10s  %s\n", elapsed, fmt.Sprintf(format, args...))
+}
+
+// watch marks the state changes of connection that ConnectionEvent doesn't
+// cover.
+func (t *timeline) watch(connection *webrtc.PeerConnection) {
+	t.mark("peer connection created")
+	connection.OnSignalingStateChange(func(state webrtc.SignalingState) {
+		t.mark("signaling state %s", state)
+	})
+	connection.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
+		t.mark("ice gathering %s", state)
+	})
+}
+
+// event marks a ConnectionEvent.
+func (t *timeline) event(event xconnwebrtc.ConnectionEvent) {
+	switch event.Type {
+	case xconnwebrtc.EventCandidateGathered, xconnwebrtc.EventCandidateSent, xconnwebrtc.EventCandidateReceived:
+		candidate := event.Candidate
+		if candidate == "" {
+			candidate = "(end of candidates)"
+		}
+		t.mark("%s %s", event.Type, candidate)
+	case xconnwebrtc.EventICEStateChanged:
+		t.mark("ice %s", event.ICEState)
+	case xconnwebrtc.EventConnectionClosed:
+		t.mark("%s (%s)", event.Type, event.PeerState)
+	case xconnwebrtc.EventDataChannelOpened, xconnwebrtc.EventHandshakeDone:
+		t.mark("%s %q", event.Type, event.Label)
+	case xconnwebrtc.EventJoined, xconnwebrtc.EventSessionClosed:
+		t.mark("%s %q session %d", event.Type, event.Label, event.SessionID)
+	case xconnwebrtc.EventAnswerReceived:
+		t.mark("%s for request %s", event.Type, event.RequestID)
+	default:
+		t.mark("%s", event.Type)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xconnio/wampproto-go/auth"
+)
+
+// Authenticator authenticates sessions against the static users and
+// anonymous access of an AuthConfig. Only methods with at least one
+// configured credential are offered.
+type Authenticator struct {
+	config *AuthConfig
+	// users is keyed by realm and authid.
+	users   map[string]map[string]UserConfig
+	methods []auth.Method
+}
+
+func NewAuthenticator(config *AuthConfig) *Authenticator {
+	a := &Authenticator{
+		config: config,
+		users:  make(map[string]map[string]UserConfig),
+	}
+	if config.Anonymous != nil {
+		a.methods = append(a.methods, auth.MethodAnonymous)
+	}
+
+	for _, user := range config.Users {
+		if a.users[user.Realm] == nil {
+			a.users[user.Realm] = make(map[string]UserConfig)
+		}
+		a.users[user.Realm][user.AuthID] = user
+
+		if user.Ticket != "" {
+			a.addMethod(auth.MethodTicket)
+		}
+		if user.Secret != "" {
+			a.addMethod(auth.MethodCRA)
+		}
+		if len(user.CryptosignKeys) > 0 {
+			a.addMethod(auth.MethodCryptoSign)
+		}
+	}
+
+	return a
+}
+
+func (a *Authenticator) addMethod(method auth.Method) {
+	if !slices.Contains(a.methods, method) {
+		a.methods = append(a.methods, method)
+	}
+}
+
+func (a *Authenticator) Methods() []auth.Method {
+	return a.methods
+}
+
+func (a *Authenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	switch request.AuthMethod() {
+	case auth.MethodAnonymous:
+		if !a.config.allowsAnonymous(request.Realm()) {
+			return nil, fmt.Errorf("anonymous access is disabled on realm %q", request.Realm())
+		}
+
+		return auth.NewResponse(request.AuthID(), a.config.Anonymous.Role, 0)
+
+	case auth.MethodTicket:
+		ticketRequest, ok := request.(*auth.TicketRequest)
+		if !ok {
+			return nil, fmt.Errorf("invalid request")
+		}
+
+		user, ok := a.users[request.Realm()][request.AuthID()]
+		if !ok || user.Ticket == "" ||
+			subtle.ConstantTimeCompare([]byte(user.Ticket), []byte(ticketRequest.Ticket())) != 1 {
+			return nil, fmt.Errorf("invalid ticket")
+		}
+
+		return auth.NewResponse(user.AuthID, user.Role, 0)
+
+	case auth.MethodCRA:
+		user, ok := a.users[request.Realm()][request.AuthID()]
+		if !ok || user.Secret == "" {
+			return nil, fmt.Errorf("unknown user %q", request.AuthID())
+		}
+
+		return auth.NewCRAResponse(user.AuthID, user.Role, user.Secret, 0), nil
+
+	case auth.MethodCryptoSign:
+		cryptosignRequest, ok := request.(*auth.RequestCryptoSign)
+		if !ok {
+			return nil, fmt.Errorf("invalid request")
+		}
+
+		user, ok := a.cryptosignUser(request.Realm(), request.AuthID(), cryptosignRequest.PublicKey())
+		if !ok {
+			return nil, fmt.Errorf("unknown publickey")
+		}
+
+		return auth.NewResponse(user.AuthID, user.Role, 0)
+
+	default:
+		return nil, fmt.Errorf("unknown authentication method: %v", request.AuthMethod())
+	}
+}
+
+// cryptosignUser finds the user of realm owning publicKey, restricted to
+// authID if the client sent one.
+func (a *Authenticator) cryptosignUser(realm, authID, publicKey string) (UserConfig, bool) {
+	owns := func(user UserConfig) bool {
+		return slices.ContainsFunc(user.CryptosignKeys, func(key string) bool {
+			return strings.EqualFold(key, publicKey)
+		})
+	}
+
+	if authID != "" {
+		user, ok := a.users[realm][authID]
+		return user, ok && owns(user)
+	}
+
+	for _, user := range a.users[realm] {
+		if owns(user) {
+			return user, true
+		}
+	}
+	return UserConfig{}, false
+}
@@ -0,0 +1,73 @@
+package main_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	provider "github.com/xconnio/xconn-webrtc-go/cmd/provider"
+)
+
+func TestAuthenticator(t *testing.T) {
+	publicKey := signalingPublicKey(t)
+	authenticator := provider.NewAuthenticator(&provider.AuthConfig{
+		Anonymous: &provider.AnonymousConfig{Role: "anonymous", Realms: []string{"public"}},
+		Users: []provider.UserConfig{
+			{AuthID: "john", Realm: "realm1", Role: "user", Ticket: "ticket", Secret: "secret"},
+			{AuthID: "jane", Realm: "realm1", Role: "admin", CryptosignKeys: []string{publicKey}},
+			{AuthID: "john", Realm: "realm2", Role: "guest", Ticket: "other"},
+		},
+	})
+
+	require.ElementsMatch(t, []auth.Method{
+		auth.MethodAnonymous, auth.MethodTicket, auth.MethodCRA, auth.MethodCryptoSign,
+	}, authenticator.Methods())
+
+	hello := func(realm, authID string) *messages.Hello {
+		return messages.NewHello(realm, authID, nil, nil, nil)
+	}
+
+	tests := []struct {
+		name    string
+		request auth.Request
+		// authID and role are the expected response, or the request must
+		// fail if role is empty.
+		authID string
+		role   string
+	}{
+		{"Anonymous", auth.NewRequest(hello("public", ""), auth.MethodAnonymous), "", "anonymous"},
+		{"AnonymousOtherRealm", auth.NewRequest(hello("realm1", ""), auth.MethodAnonymous), "", ""},
+		{"Ticket", auth.NewTicketRequest(hello("realm1", "john"), "ticket"), "john", "user"},
+		{"TicketPerRealm", auth.NewTicketRequest(hello("realm2", "john"), "other"), "john", "guest"},
+		{"TicketOfOtherRealm", auth.NewTicketRequest(hello("realm2", "john"), "ticket"), "", ""},
+		{"TicketUnknownUser", auth.NewTicketRequest(hello("public", "john"), "ticket"), "", ""},
+		{"TicketUserWithoutTicket", auth.NewTicketRequest(hello("realm1", "jane"), ""), "", ""},
+		{"CRA", auth.NewRequest(hello("realm1", "john"), auth.MethodCRA), "john", "user"},
+		{"CRAUserWithoutSecret", auth.NewRequest(hello("realm2", "john"), auth.MethodCRA), "", ""},
+		{"CRAUnknownUser", auth.NewRequest(hello("realm1", "joe"), auth.MethodCRA), "", ""},
+		{"CryptoSign", auth.NewCryptoSignRequest(hello("realm1", "jane"), publicKey), "jane", "admin"},
+		{"CryptoSignWithoutAuthID", auth.NewCryptoSignRequest(hello("realm1", ""), publicKey), "jane", "admin"},
+		{"CryptoSignOtherAuthID", auth.NewCryptoSignRequest(hello("realm1", "john"), publicKey), "", ""},
+		{"CryptoSignOtherRealm", auth.NewCryptoSignRequest(hello("realm2", ""), publicKey), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := authenticator.Authenticate(tt.request)
+			if tt.role == "" {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.authID, response.AuthID())
+			require.Equal(t, tt.role, response.AuthRole())
+		})
+	}
+
+	response, err := authenticator.Authenticate(auth.NewRequest(hello("realm1", "john"), auth.MethodCRA))
+	require.NoError(t, err)
+	require.IsType(t, &auth.CRAResponse{}, response)
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+const (
+	defaultWebSocketAddress         = "0.0.0.0:8080"
+	defaultProcedureWebRTCOffer     = "io.xconn.webrtc.offer"
+	defaultTopicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+	defaultTopicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
+
+	modeEmbedded = "embedded"
+	modeExternal = "external"
+)
+
+// Config is the provider's configuration file.
+type Config struct {
+	// Mode is embedded (default), serving an embedded router configured by
+	// Listen, Realms and Auth, or external, signaling over and proxying WebRTC
+	// sessions to the router at Signaling.URL, reconnecting when it drops.
+	Mode string `yaml:"mode"`
+	// Upstream is where external mode proxies WebRTC sessions: a ws:// or
+	// wss:// URL, or rs://host:port for RawSocket. Defaults to Signaling.URL.
+	Upstream  string          `yaml:"upstream"`
+	Listen    ListenConfig    `yaml:"listen"`
+	Signaling SignalingConfig `yaml:"signaling"`
+	Realms    []RealmConfig   `yaml:"realms"`
+	Auth      AuthConfig      `yaml:"auth"`
+	WebRTC    WebRTCConfig    `yaml:"webrtc"`
+}
+
+// ListenConfig are the addresses the embedded router serves WAMP clients on.
+type ListenConfig struct {
+	// WebSocket defaults to 0.0.0.0:8080.
+	WebSocket string `yaml:"websocket"`
+	// RawSocket is optional.
+	RawSocket string `yaml:"rawsocket"`
+}
+
+// SignalingConfig is how the provider joins the router to receive offers.
+type SignalingConfig struct {
+	// URL defaults to the WebSocket listener on localhost.
+	URL   string `yaml:"url"`
+	Realm string `yaml:"realm"`
+	// AuthID with one of Ticket, Secret (WAMP-CRA) or PrivateKey (hex
+	// Ed25519 seed for cryptosign) authenticates the provider's session;
+	// without any it joins anonymously.
+	AuthID                   string `yaml:"authid"`
+	Ticket                   string `yaml:"ticket"`
+	Secret                   string `yaml:"secret"`
+	PrivateKey               string `yaml:"private_key"`
+	ProcedureOffer           string `yaml:"procedure_offer"`
+	TopicOffererOnCandidate  string `yaml:"topic_offerer_on_candidate"`
+	TopicAnswererOnCandidate string `yaml:"topic_answerer_on_candidate"`
+	ProcedureFingerprint     string `yaml:"procedure_fingerprint"`
+}
+
+type RealmConfig struct {
+	Name  string       `yaml:"name"`
+	Roles []RoleConfig `yaml:"roles"`
+}
+
+type RoleConfig struct {
+	Name        string             `yaml:"name"`
+	Permissions []PermissionConfig `yaml:"permissions"`
+}
+
+type PermissionConfig struct {
+	URI string `yaml:"uri"`
+	// Match is exact (default), prefix or wildcard.
+	Match     string `yaml:"match"`
+	Call      bool   `yaml:"call"`
+	Register  bool   `yaml:"register"`
+	Publish   bool   `yaml:"publish"`
+	Subscribe bool   `yaml:"subscribe"`
+}
+
+// AuthConfig configures who may join, over both the router's listeners and
+// WebRTC.
+type AuthConfig struct {
+	Anonymous *AnonymousConfig `yaml:"anonymous"`
+	// UsersFile is a YAML file with a "users" list, merged with Users.
+	UsersFile string       `yaml:"users_file"`
+	Users     []UserConfig `yaml:"users"`
+}
+
+// AnonymousConfig admits anonymous sessions with Role to Realms (all realms
+// if empty).
+type AnonymousConfig struct {
+	Role   string   `yaml:"role"`
+	Realms []string `yaml:"realms"`
+}
+
+// UserConfig is a static user. Each credential set enables the matching
+// method: Ticket for ticket, Secret for WAMP-CRA, CryptosignKeys (hex
+// Ed25519 public keys) for cryptosign.
+type UserConfig struct {
+	AuthID         string   `yaml:"authid"`
+	Realm          string   `yaml:"realm"`
+	Role           string   `yaml:"role"`
+	Ticket         string   `yaml:"ticket"`
+	Secret         string   `yaml:"secret"`
+	CryptosignKeys []string `yaml:"cryptosign_keys"`
+}
+
+type usersFile struct {
+	Users []UserConfig `yaml:"users"`
+}
+
+type ICEServerConfig struct {
+	URLs       []string `yaml:"urls"`
+	Username   string   `yaml:"username"`
+	Credential string   `yaml:"credential"`
+}
+
+type WebRTCConfig struct {
+	ICEServers []ICEServerConfig `yaml:"ice_servers"`
+	// ICEPolicy is all (default), relay, no-host or mdns.
+	ICEPolicy string `yaml:"ice_policy"`
+	// Certificate is a PEM file holding the DTLS certificate, created on
+	// first start if missing.
+	Certificate string `yaml:"certificate"`
+	// Serializers restricts WebRTC sessions to json, msgpack and/or cbor.
+	Serializers       []string      `yaml:"serializers"`
+	MaxSessions       int           `yaml:"max_sessions"`
+	MinMessageSize    int           `yaml:"min_message_size"`
+	TrickleCutoff     time.Duration `yaml:"trickle_cutoff"`
+	InheritIdentity   bool          `yaml:"inherit_identity"`
+	IdentityTicketTTL time.Duration `yaml:"identity_ticket_ttl"`
+}
+
+// serializerID maps a configured serializer name to its id.
+func serializerID(name string) (transports.Serializer, bool) {
+	switch name {
+	case "json":
+		return transports.SerializerJson, true
+	case "msgpack":
+		return transports.SerializerMsgpack, true
+	case "cbor":
+		return transports.SerializerCbor, true
+	default:
+		return 0, false
+	}
+}
+
+// loadConfig reads, defaults and validates the configuration at path.
+func loadConfig(path string) (*Config, error) {
+	var config Config
+	if err := decodeYAML(path, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Auth.UsersFile != "" {
+		var users usersFile
+		// A relative users file is relative to the config file.
+		usersPath := config.Auth.UsersFile
+		if !filepath.IsAbs(usersPath) {
+			usersPath = filepath.Join(filepath.Dir(path), usersPath)
+		}
+		if err := decodeYAML(usersPath, &users); err != nil {
+			return nil, err
+		}
+		config.Auth.Users = append(config.Auth.Users, users.Users...)
+	}
+
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%w", path, err)
+	}
+	return &config, nil
+}
+
+func decodeYAML(path string, out any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(out); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Mode == "" {
+		c.Mode = modeEmbedded
+	}
+	if c.Mode == modeExternal && c.Upstream == "" {
+		c.Upstream = c.Signaling.URL
+	}
+	if c.Mode == modeEmbedded && c.Listen.WebSocket == "" {
+		c.Listen.WebSocket = defaultWebSocketAddress
+	}
+	if c.Signaling.URL == "" && c.Mode == modeEmbedded {
+		if _, port, err := net.SplitHostPort(c.Listen.WebSocket); err == nil {
+			c.Signaling.URL = fmt.Sprintf("ws://localhost:%s/ws", port)
+		}
+	}
+	if c.Signaling.ProcedureOffer == "" {
+		c.Signaling.ProcedureOffer = defaultProcedureWebRTCOffer
+	}
+	if c.Signaling.TopicOffererOnCandidate == "" {
+		c.Signaling.TopicOffererOnCandidate = defaultTopicOffererOnCandidate
+	}
+	if c.Signaling.TopicAnswererOnCandidate == "" {
+		c.Signaling.TopicAnswererOnCandidate = defaultTopicAnswererOnCandidate
+	}
+}
+
+// validate reports every problem in the configuration at once, one per line.
+func (c *Config) validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("  "+format, args...))
+	}
+
+	switch c.Mode {
+	case modeEmbedded:
+		c.validateEmbedded(fail)
+	case modeExternal:
+		c.validateExternal(fail)
+	default:
+		fail("mode: unknown mode %q, must be %s or %s", c.Mode, modeEmbedded, modeExternal)
+	}
+
+	credentials := 0
+	for _, credential := range []string{c.Signaling.Ticket, c.Signaling.Secret, c.Signaling.PrivateKey} {
+		if credential != "" {
+			credentials++
+		}
+	}
+	if credentials > 1 {
+		fail("signaling: only one of ticket, secret and private_key may be set")
+	}
+	if credentials > 0 && c.Signaling.AuthID == "" {
+		fail("signaling.authid: required with signaling credentials")
+	}
+	if c.Signaling.PrivateKey != "" {
+		if decoded, err := hex.DecodeString(c.Signaling.PrivateKey); err != nil || len(decoded) != 32 {
+			fail("signaling.private_key: must be a hex-encoded Ed25519 private key seed")
+		}
+	}
+
+	for i, server := range c.WebRTC.ICEServers {
+		if len(server.URLs) == 0 {
+			fail("webrtc.ice_servers[%d].urls: must not be empty", i)
+		}
+	}
+	if policy, ok := parseICEPolicy(c.WebRTC.ICEPolicy); !ok {
+		fail("webrtc.ice_policy: unknown ICE policy %q", c.WebRTC.ICEPolicy)
+	} else if policy == xconnwebrtc.ICEPolicyRelay && !c.hasTURNServer() {
+		fail("webrtc.ice_policy: relay requires at least one turn: or turns: server")
+	}
+	for i, name := range c.WebRTC.Serializers {
+		if _, ok := serializerID(name); !ok {
+			fail("webrtc.serializers[%d]: unknown serializer %q", i, name)
+		}
+	}
+	if c.WebRTC.MaxSessions < 0 {
+		fail("webrtc.max_sessions: must not be negative")
+	}
+	if c.WebRTC.MinMessageSize < 0 {
+		fail("webrtc.min_message_size: must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateEmbedded checks the embedded router's listeners, realms and users.
+func (c *Config) validateEmbedded(fail func(format string, args ...any)) {
+	if _, _, err := net.SplitHostPort(c.Listen.WebSocket); err != nil {
+		fail("listen.websocket: %v", err)
+	}
+	if c.Listen.RawSocket != "" {
+		if _, _, err := net.SplitHostPort(c.Listen.RawSocket); err != nil {
+			fail("listen.rawsocket: %v", err)
+		}
+	}
+
+	roles := make(map[string]map[string]bool)
+	if len(c.Realms) == 0 {
+		fail("realms: at least one realm is required")
+	}
+	for i, realm := range c.Realms {
+		if realm.Name == "" {
+			fail("realms[%d].name: must not be empty", i)
+			continue
+		}
+		if roles[realm.Name] != nil {
+			fail("realms[%d].name: duplicate realm %q", i, realm.Name)
+			continue
+		}
+		roles[realm.Name] = make(map[string]bool)
+		for j, role := range realm.Roles {
+			if role.Name == "" {
+				fail("realms[%d].roles[%d].name: must not be empty", i, j)
+				continue
+			}
+			roles[realm.Name][role.Name] = true
+			for k, permission := range role.Permissions {
+				if permission.URI == "" && permission.Match != "prefix" {
+					fail("realms[%d].roles[%d].permissions[%d].uri: must not be empty unless match is prefix", i, j, k)
+				}
+				switch permission.Match {
+				case "", "exact", "prefix", "wildcard":
+				default:
+					fail("realms[%d].roles[%d].permissions[%d].match: unknown match policy %q", i, j, k,
+						permission.Match)
+				}
+			}
+		}
+	}
+
+	if c.Signaling.Realm == "" {
+		fail("signaling.realm: must not be empty")
+	} else if roles[c.Signaling.Realm] == nil {
+		fail("signaling.realm: unknown realm %q", c.Signaling.Realm)
+	}
+	if c.Signaling.Ticket != "" || c.Signaling.Secret != "" || c.Signaling.PrivateKey != "" {
+		if !c.hasSignalingUser() {
+			fail("signaling.authid: no user %q in realm %q with these credentials", c.Signaling.AuthID,
+				c.Signaling.Realm)
+		}
+	} else if !c.Auth.allowsAnonymous(c.Signaling.Realm) {
+		fail("signaling: credentials required unless auth.anonymous admits realm %q", c.Signaling.Realm)
+	}
+
+	if anonymous := c.Auth.Anonymous; anonymous != nil {
+		if anonymous.Role == "" {
+			fail("auth.anonymous.role: must not be empty")
+		}
+		realms := anonymous.Realms
+		if len(realms) == 0 {
+			for _, realm := range c.Realms {
+				realms = append(realms, realm.Name)
+			}
+		}
+		for _, realm := range realms {
+			if roles[realm] == nil {
+				fail("auth.anonymous.realms: unknown realm %q", realm)
+			} else if anonymous.Role != "" && !roles[realm][anonymous.Role] {
+				fail("auth.anonymous.role: realm %q has no role %q", realm, anonymous.Role)
+			}
+		}
+	}
+
+	users := make(map[string]bool)
+	for i, user := range c.Auth.Users {
+		if user.AuthID == "" {
+			fail("auth.users[%d].authid: must not be empty", i)
+		}
+		if roles[user.Realm] == nil {
+			fail("auth.users[%d].realm: unknown realm %q", i, user.Realm)
+		} else if !roles[user.Realm][user.Role] {
+			fail("auth.users[%d].role: realm %q has no role %q", i, user.Realm, user.Role)
+		}
+		key := user.Realm + "\x00" + user.AuthID
+		if users[key] {
+			fail("auth.users[%d]: duplicate user %q in realm %q", i, user.AuthID, user.Realm)
+		}
+		users[key] = true
+		if user.Ticket == "" && user.Secret == "" && len(user.CryptosignKeys) == 0 {
+			fail("auth.users[%d]: no ticket, secret or cryptosign_keys", i)
+		}
+		for j, key := range user.CryptosignKeys {
+			if decoded, err := hex.DecodeString(key); err != nil || len(decoded) != 32 {
+				fail("auth.users[%d].cryptosign_keys[%d]: must be a hex-encoded Ed25519 public key", i, j)
+			}
+		}
+	}
+}
+
+// validateExternal checks the external router to signal over and proxy to;
+// the embedded router's settings must be absent.
+func (c *Config) validateExternal(fail func(format string, args ...any)) {
+	if c.Signaling.URL == "" {
+		fail("signaling.url: required in external mode")
+	} else if !strings.HasPrefix(c.Signaling.URL, "ws://") && !strings.HasPrefix(c.Signaling.URL, "wss://") {
+		fail("signaling.url: must be a ws:// or wss:// URL")
+	}
+	if c.Signaling.Realm == "" {
+		fail("signaling.realm: must not be empty")
+	}
+	if _, err := c.upstream(); err != nil {
+		fail("upstream: %v", err)
+	}
+
+	if c.Listen != (ListenConfig{}) {
+		fail("listen: only used in embedded mode")
+	}
+	if len(c.Realms) > 0 {
+		fail("realms: only used in embedded mode")
+	}
+	if c.WebRTC.InheritIdentity {
+		fail("webrtc.inherit_identity: only used in embedded mode")
+	}
+	if c.Auth.Anonymous != nil || c.Auth.UsersFile != "" || len(c.Auth.Users) > 0 {
+		fail("auth: only used in embedded mode")
+	}
+}
+
+// hasSignalingUser reports whether the embedded router has a user matching
+// the signaling session's credentials.
+func (c *Config) hasSignalingUser() bool {
+	for _, user := range c.Auth.Users {
+		if user.Realm != c.Signaling.Realm || user.AuthID != c.Signaling.AuthID {
+			continue
+		}
+
+		switch {
+		case c.Signaling.Ticket != "":
+			return user.Ticket == c.Signaling.Ticket
+		case c.Signaling.Secret != "":
+			return user.Secret == c.Signaling.Secret
+		default:
+			seed, err := hex.DecodeString(c.Signaling.PrivateKey)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return false
+			}
+			// The second half of an Ed25519 private key is its public key.
+			publicKey := hex.EncodeToString(ed25519.NewKeyFromSeed(seed)[ed25519.SeedSize:])
+			return slices.ContainsFunc(user.CryptosignKeys, func(key string) bool {
+				return strings.EqualFold(key, publicKey)
+			})
+		}
+	}
+	return false
+}
+
+// signalingAuthenticator authenticates the provider's signaling session with
+// the configured credentials, anonymously if there are none.
+func (c *Config) signalingAuthenticator() (auth.ClientAuthenticator, error) {
+	switch {
+	case c.Signaling.Ticket != "":
+		return auth.NewTicketAuthenticator(c.Signaling.AuthID, c.Signaling.Ticket, nil), nil
+	case c.Signaling.Secret != "":
+		return auth.NewWAMPCRAAuthenticator(c.Signaling.AuthID, c.Signaling.Secret, nil), nil
+	case c.Signaling.PrivateKey != "":
+		return auth.NewCryptoSignAuthenticator(c.Signaling.AuthID, c.Signaling.PrivateKey, nil)
+	default:
+		return auth.NewAnonymousAuthenticator(c.Signaling.AuthID, nil), nil
+	}
+}
+
+// upstream returns the dialer external mode proxies WebRTC sessions with.
+func (c *Config) upstream() (xconnwebrtc.UpstreamDialer, error) {
+	parsed, err := url.Parse(c.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "ws", "wss":
+		return xconnwebrtc.WebSocketUpstream(c.Upstream), nil
+	case "rs", "tcp":
+		if _, _, err = net.SplitHostPort(parsed.Host); err != nil {
+			return nil, err
+		}
+		return xconnwebrtc.RawSocketUpstream(xconn.NetworkTCP, parsed.Host), nil
+	default:
+		return nil, fmt.Errorf("unsupported URL %q, must be ws://, wss:// or rs://", c.Upstream)
+	}
+}
+
+// parseICEPolicy maps a configured ICE policy name to its value; empty means
+// all.
+func parseICEPolicy(name string) (xconnwebrtc.ICEPolicy, bool) {
+	if name == "" {
+		return xconnwebrtc.ICEPolicyAll, true
+	}
+
+	for _, policy := range []xconnwebrtc.ICEPolicy{
+		xconnwebrtc.ICEPolicyAll, xconnwebrtc.ICEPolicyRelay, xconnwebrtc.ICEPolicyNoHost, xconnwebrtc.ICEPolicyMDNS,
+	} {
+		if policy.String() == name {
+			return policy, true
+		}
+	}
+	return 0, false
+}
+
+func (a *AuthConfig) allowsAnonymous(realm string) bool {
+	return a.Anonymous != nil && (len(a.Anonymous.Realms) == 0 || slices.Contains(a.Anonymous.Realms, realm))
+}
+
+func (c *Config) hasTURNServer() bool {
+	for _, server := range c.WebRTC.ICEServers {
+		for _, url := range server.URLs {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Config) iceServers() []xconnwebrtc.ICEServer {
+	servers := make([]xconnwebrtc.ICEServer, 0, len(c.WebRTC.ICEServers))
+	for _, server := range c.WebRTC.ICEServers {
+		servers = append(servers, xconnwebrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return servers
+}
+
+func (c *Config) serializerIDs() []transports.Serializer {
+	ids := make([]transports.Serializer, 0, len(c.WebRTC.Serializers))
+	for _, name := range c.WebRTC.Serializers {
+		id, _ := serializerID(name)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (r *RealmConfig) routerConfig() *xconn.RealmConfig {
+	config := &xconn.RealmConfig{}
+	for _, role := range r.Roles {
+		realmRole := xconn.RealmRole{Name: role.Name}
+		for _, permission := range role.Permissions {
+			match := permission.Match
+			if match == "" {
+				match = "exact"
+			}
+			realmRole.Permissions = append(realmRole.Permissions, xconn.Permission{
+				URI:            permission.URI,
+				MatchPolicy:    match,
+				AllowCall:      permission.Call,
+				AllowRegister:  permission.Register,
+				AllowPublish:   permission.Publish,
+				AllowSubscribe: permission.Subscribe,
+			})
+		}
+		config.Roles = append(config.Roles, realmRole)
+	}
+	return config
+}
@@ -0,0 +1,260 @@
+package main_test
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	provider "github.com/xconnio/xconn-webrtc-go/cmd/provider"
+)
+
+const signalingSeed = "0101010101010101010101010101010101010101010101010101010101010101"
+
+func signalingPublicKey(t *testing.T) string {
+	seed, err := hex.DecodeString(signalingSeed)
+	require.NoError(t, err)
+	return hex.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+}
+
+// embeddedConfig is a valid embedded configuration with one realm, open to
+// anonymous sessions, and one user holding every kind of credential.
+func embeddedConfig(t *testing.T) *provider.Config {
+	return &provider.Config{
+		Signaling: provider.SignalingConfig{Realm: "realm1"},
+		Realms: []provider.RealmConfig{{
+			Name: "realm1",
+			Roles: []provider.RoleConfig{
+				{Name: "anonymous"},
+				{Name: "user"},
+			},
+		}},
+		Auth: provider.AuthConfig{
+			Anonymous: &provider.AnonymousConfig{Role: "anonymous"},
+			Users: []provider.UserConfig{{
+				AuthID:         "john",
+				Realm:          "realm1",
+				Role:           "user",
+				Ticket:         "ticket",
+				Secret:         "secret",
+				CryptosignKeys: []string{signalingPublicKey(t)},
+			}},
+		},
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(config *provider.Config)
+		// errors are the messages validate must report, none if empty.
+		errors []string
+	}{
+		{
+			name:   "Valid",
+			mutate: func(*provider.Config) {},
+		},
+		{
+			name:   "UnknownMode",
+			mutate: func(config *provider.Config) { config.Mode = "hybrid" },
+			errors: []string{`mode: unknown mode "hybrid", must be embedded or external`},
+		},
+		{
+			name: "SignalingTicket",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Ticket = "john", "ticket"
+			},
+		},
+		{
+			name: "SignalingWrongTicket",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Ticket = "john", "secret"
+			},
+			errors: []string{`signaling.authid: no user "john" in realm "realm1" with these credentials`},
+		},
+		{
+			name: "SignalingSecret",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Secret = "john", "secret"
+			},
+		},
+		{
+			name: "SignalingWrongSecret",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Secret = "john", "ticket"
+			},
+			errors: []string{`signaling.authid: no user "john" in realm "realm1" with these credentials`},
+		},
+		{
+			name: "SignalingPrivateKey",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.PrivateKey = "john", signalingSeed
+			},
+		},
+		{
+			name: "SignalingUnknownPrivateKey",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID = "john"
+				config.Signaling.PrivateKey = strings.Repeat("02", ed25519.SeedSize)
+			},
+			errors: []string{`signaling.authid: no user "john" in realm "realm1" with these credentials`},
+		},
+		{
+			name: "SignalingUserOfOtherAuthID",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Ticket = "jane", "ticket"
+			},
+			errors: []string{`signaling.authid: no user "jane" in realm "realm1" with these credentials`},
+		},
+		{
+			name: "SignalingCredentialsWithoutAuthID",
+			mutate: func(config *provider.Config) {
+				config.Signaling.Ticket = "ticket"
+			},
+			errors: []string{
+				`signaling.authid: no user "" in realm "realm1" with these credentials`,
+				"signaling.authid: required with signaling credentials",
+			},
+		},
+		{
+			name: "SignalingSeveralCredentials",
+			mutate: func(config *provider.Config) {
+				config.Signaling.AuthID, config.Signaling.Ticket, config.Signaling.Secret = "john", "ticket", "secret"
+			},
+			errors: []string{"signaling: only one of ticket, secret and private_key may be set"},
+		},
+		{
+			name: "SignalingAnonymousDisabled",
+			mutate: func(config *provider.Config) {
+				config.Auth.Anonymous = nil
+			},
+			errors: []string{`signaling: credentials required unless auth.anonymous admits realm "realm1"`},
+		},
+		{
+			name: "UnknownSignalingRealm",
+			mutate: func(config *provider.Config) {
+				config.Signaling.Realm = "realm2"
+			},
+			errors: []string{`signaling.realm: unknown realm "realm2"`},
+		},
+		{
+			name: "AnonymousUnknownRole",
+			mutate: func(config *provider.Config) {
+				config.Auth.Anonymous.Role = "guest"
+			},
+			errors: []string{`auth.anonymous.role: realm "realm1" has no role "guest"`},
+		},
+		{
+			name: "DuplicateUser",
+			mutate: func(config *provider.Config) {
+				config.Auth.Users = append(config.Auth.Users, config.Auth.Users[0])
+			},
+			errors: []string{`auth.users[1]: duplicate user "john" in realm "realm1"`},
+		},
+		{
+			name: "UserWithoutCredentials",
+			mutate: func(config *provider.Config) {
+				config.Auth.Users = append(config.Auth.Users, provider.UserConfig{
+					AuthID: "jane",
+					Realm:  "realm1",
+					Role:   "user",
+				})
+			},
+			errors: []string{"auth.users[1]: no ticket, secret or cryptosign_keys"},
+		},
+		{
+			name: "UnknownICEPolicy",
+			mutate: func(config *provider.Config) {
+				config.WebRTC.ICEPolicy = "loopback"
+			},
+			errors: []string{`webrtc.ice_policy: unknown ICE policy "loopback"`},
+		},
+		{
+			name: "RelayWithoutTURN",
+			mutate: func(config *provider.Config) {
+				config.WebRTC.ICEPolicy = "relay"
+				config.WebRTC.ICEServers = []provider.ICEServerConfig{{URLs: []string{"stun:stun.example.com"}}}
+			},
+			errors: []string{"webrtc.ice_policy: relay requires at least one turn: or turns: server"},
+		},
+		{
+			name: "UnknownSerializer",
+			mutate: func(config *provider.Config) {
+				config.WebRTC.Serializers = []string{"cbor", "xml"}
+			},
+			errors: []string{`webrtc.serializers[1]: unknown serializer "xml"`},
+		},
+		{
+			name: "External",
+			mutate: func(config *provider.Config) {
+				config.Mode = "external"
+				config.Signaling.URL = "ws://router:8080/ws"
+				config.Realms = nil
+				config.Auth = provider.AuthConfig{}
+			},
+		},
+		{
+			name: "ExternalEmbeddedSettings",
+			mutate: func(config *provider.Config) {
+				config.Mode = "external"
+				config.Signaling.URL = "ws://router:8080/ws"
+				config.WebRTC.InheritIdentity = true
+			},
+			errors: []string{
+				"realms: only used in embedded mode",
+				"webrtc.inherit_identity: only used in embedded mode",
+				"auth: only used in embedded mode",
+			},
+		},
+		{
+			name: "ExternalWithoutURL",
+			mutate: func(config *provider.Config) {
+				config.Mode = "external"
+				config.Realms = nil
+				config.Auth = provider.AuthConfig{}
+			},
+			errors: []string{
+				"signaling.url: required in external mode",
+				`upstream: unsupported URL "", must be ws://, wss:// or rs://`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := embeddedConfig(t)
+			tt.mutate(config)
+
+			err := config.Validate()
+			if len(tt.errors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			var messages []string
+			for _, line := range strings.Split(err.Error(), "\n") {
+				messages = append(messages, strings.TrimSpace(line))
+			}
+			require.Equal(t, tt.errors, messages)
+		})
+	}
+}
+
+func TestLoadExampleConfig(t *testing.T) {
+	config, err := provider.LoadConfig("provider.yaml")
+	require.NoError(t, err)
+
+	_, err = provider.NewProviderConfig(config)
+	require.NoError(t, err)
+}
+
+func TestNewProviderConfigUnknownICEPolicy(t *testing.T) {
+	config := embeddedConfig(t)
+	config.WebRTC.ICEPolicy = "loopback"
+
+	_, err := provider.NewProviderConfig(config)
+	require.EqualError(t, err, `unknown ICE policy "loopback"`)
+}
@@ -0,0 +1,12 @@
+package main
+
+var (
+	LoadConfig        = loadConfig
+	NewProviderConfig = newProviderConfig
+)
+
+// Validate defaults and validates c as loadConfig does.
+func (c *Config) Validate() error {
+	c.setDefaults()
+	return c.validate()
+}
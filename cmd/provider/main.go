@@ -2,143 +2,138 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/xconnio/wampproto-go/auth"
 	"github.com/xconnio/wampproto-go/serializers"
 	"github.com/xconnio/xconn-go"
 	"github.com/xconnio/xconn-webrtc-go"
 )
 
-const (
-	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
-	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
-	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
-
-	testRealm     = "realm1"
-	testSecret    = "hello"
-	testTicket    = "hello"
-	testPublicKey = "f0e3cff77bd851015a99d873e302803d83e693cde41ffe545b26124713bdb08b"
-)
-
-type Authenticator struct{}
-
-func NewAuthenticator() *Authenticator {
-	return &Authenticator{}
-}
-
-func (a *Authenticator) Methods() []auth.Method {
-	return []auth.Method{auth.MethodAnonymous, auth.MethodTicket, auth.MethodCRA, auth.MethodCryptoSign}
-}
-
-func (a *Authenticator) Authenticate(request auth.Request) (auth.Response, error) {
-	switch request.AuthMethod() {
-	case auth.MethodAnonymous:
-		if request.Realm() == testRealm {
-			return auth.NewResponse(request.AuthID(), "anonymous", 0)
-		}
-
-		return nil, fmt.Errorf("invalid realm")
-
-	case auth.MethodTicket:
-		ticketRequest, ok := request.(*auth.TicketRequest)
-		if !ok {
-			return nil, fmt.Errorf("invalid request")
-		}
-
-		if ticketRequest.Realm() == testRealm && ticketRequest.Ticket() == testTicket {
-			return auth.NewResponse(ticketRequest.AuthID(), "anonymous", 0)
-		}
+func main() {
+	configPath := flag.String("config", "provider.yaml", "path to the configuration file")
+	flag.Parse()
 
-		return nil, fmt.Errorf("invalid ticket")
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	case auth.MethodCRA:
-		if request.Realm() == testRealm {
-			return auth.NewCRAResponse(request.AuthID(), "anonymous", testSecret, 0), nil
-		}
+	cfg, err := newProviderConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		return nil, fmt.Errorf("invalid realm")
+	if config.Mode == modeEmbedded {
+		r, closeServer := startRouter(config)
+		defer closeServer()
 
-	case auth.MethodCryptoSign:
-		cryptosignRequest, ok := request.(*auth.RequestCryptoSign)
-		if !ok {
-			return nil, fmt.Errorf("invalid request")
+		cfg.Router = r
+		cfg.Authenticator = NewAuthenticator(&config.Auth)
+	} else {
+		cfg.Upstream, err = config.upstream()
+		if err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		if cryptosignRequest.Realm() == testRealm && cryptosignRequest.PublicKey() == testPublicKey {
-			return auth.NewResponse(cryptosignRequest.AuthID(), "anonymous", 0)
-		}
+	authenticator, err := config.signalingAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		return nil, fmt.Errorf("unknown publickey")
+	// Close server if SIGINT (CTRL-c) received.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	default:
-		return nil, fmt.Errorf("unknown authentication method: %v", request.AuthMethod())
+	webRtcManager := xconnwebrtc.NewWebRTCHandler()
+	err = webRtcManager.Serve(ctx, &xconnwebrtc.ServeConfig{
+		URL:           config.Signaling.URL,
+		Realm:         config.Signaling.Realm,
+		Authenticator: authenticator,
+		Provider:      cfg,
+		OnConnect: func(_ *xconn.Session) {
+			log.Infof("webrtc provider signaling on %s", config.Signaling.URL)
+		},
+		OnDisconnect: func(err error) {
+			log.Warnf("webrtc provider signaling lost, reconnecting: %v", err)
+		},
+	})
+	if err != nil {
+		log.Fatal("Failed to setup webRtc provider:", err)
 	}
 }
 
-func main() {
+// startRouter starts the embedded router with the configured realms and
+// listeners, returning a function that stops it.
+func startRouter(config *Config) (*xconn.Router, func()) {
 	r, err := xconn.NewRouter(xconn.DefaultRouterConfig())
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := r.AddRealm("realm1", &xconn.RealmConfig{
-		Roles: []xconn.RealmRole{
-			{
-				Name: "anonymous",
-				Permissions: []xconn.Permission{{
-					URI:            "io.xconn.webrtc.",
-					MatchPolicy:    "prefix",
-					AllowSubscribe: true,
-					AllowPublish:   true,
-					AllowRegister:  true,
-					AllowCall:      true,
-				}},
-			},
-		},
-	}); err != nil {
-		log.Fatal(err)
+	for i := range config.Realms {
+		if err := r.AddRealm(config.Realms[i].Name, config.Realms[i].routerConfig()); err != nil {
+			log.Fatal(err)
+		}
 	}
-	defer r.Close()
 
-	server := xconn.NewServer(r, nil, nil)
-	closer, err := server.ListenAndServeWebSocket(xconn.NetworkTCP, "0.0.0.0:8080")
+	server := xconn.NewServer(r, NewAuthenticator(&config.Auth), nil)
+	closer, err := server.ListenAndServeWebSocket(xconn.NetworkTCP, config.Listen.WebSocket)
 	if err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
-	defer func() { _ = closer.Close() }()
 
-	session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
-	if err != nil {
-		log.Fatal("Failed to connect to server:", err)
+	closers := []func() error{closer.Close}
+	if config.Listen.RawSocket != "" {
+		rawSocketCloser, err := server.ListenAndServeRawSocket(xconn.NetworkTCP, config.Listen.RawSocket)
+		if err != nil {
+			log.Fatal("Failed to start server:", err)
+		}
+		closers = append(closers, rawSocketCloser.Close)
 	}
 
-	webRtcManager := xconnwebrtc.NewWebRTCHandler()
+	return r, func() {
+		for _, closeListener := range closers {
+			_ = closeListener()
+		}
+		r.Close()
+	}
+}
+
+// newProviderConfig maps the webrtc and signaling sections to a provider
+// config; Serve fills in the session.
+func newProviderConfig(config *Config) (*xconnwebrtc.ProviderConfig, error) {
 	cfg := &xconnwebrtc.ProviderConfig{
-		Session:                     session,
-		ProcedureHandleOffer:        procedureWebRTCOffer,
-		TopicHandleRemoteCandidates: topicAnswererOnCandidate,
-		TopicPublishLocalCandidate:  topicOffererOnCandidate,
+		ProcedureHandleOffer:        config.Signaling.ProcedureOffer,
+		TopicHandleRemoteCandidates: config.Signaling.TopicAnswererOnCandidate,
+		TopicPublishLocalCandidate:  config.Signaling.TopicOffererOnCandidate,
+		ProcedureFingerprint:        config.Signaling.ProcedureFingerprint,
 		Serializer:                  &serializers.CBORSerializer{},
-		Authenticator:               NewAuthenticator(),
-		Router:                      r,
-		ICEServers: []xconnwebrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
+		InheritIdentity:             config.WebRTC.InheritIdentity,
+		IdentityTicketTTL:           config.WebRTC.IdentityTicketTTL,
+		ICEServers:                  config.iceServers(),
+		TrickleCutoff:               config.WebRTC.TrickleCutoff,
+		MaxSessions:                 config.WebRTC.MaxSessions,
+		MinMessageSize:              config.WebRTC.MinMessageSize,
+		Serializers:                 config.serializerIDs(),
 	}
-	if err := webRtcManager.Setup(cfg); err != nil {
-		log.Fatal("Failed to setup webRtc provider:", err)
+	policy, ok := parseICEPolicy(config.WebRTC.ICEPolicy)
+	if !ok {
+		return nil, fmt.Errorf("unknown ICE policy %q", config.WebRTC.ICEPolicy)
 	}
+	cfg.ICEPolicy = policy
 
-	// Close server if SIGINT (CTRL-c) received.
-	closeChan := make(chan os.Signal, 1)
-	signal.Notify(closeChan, os.Interrupt)
-
-	select {
-	case <-closeChan:
-	case <-session.Done():
+	if config.WebRTC.Certificate != "" {
+		certificate, err := xconnwebrtc.LoadOrCreateCertificate(config.WebRTC.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificate = certificate
 	}
+
+	return cfg, nil
 }
@@ -0,0 +1,82 @@
+package xconnwebrtc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeviceURIs are the signaling procedure and topics a single device accepts
+// offers on. Giving every device its own URIs lets a backend reach one
+// specific device behind NAT: the backend is the offerer and ends up with a
+// WebRTCSession to the device, which answers through a WebRTCProvider.
+type DeviceURIs struct {
+	ProcedureAcceptOffer     string
+	TopicOffererOnCandidate  string
+	TopicAnswererOnCandidate string
+}
+
+// NewDeviceURIs derives a device's signaling URIs from a prefix shared by the
+// fleet and the device's ID, e.g. prefix "com.example.devices" and ID "42"
+// give the procedure "com.example.devices.42.accept_offer".
+func NewDeviceURIs(prefix, deviceID string) (DeviceURIs, error) {
+	if prefix == "" {
+		return DeviceURIs{}, fmt.Errorf("device URI prefix must not be empty")
+	}
+	if deviceID == "" || strings.ContainsAny(deviceID, ". \t\n") {
+		return DeviceURIs{}, fmt.Errorf("invalid device ID %q", deviceID)
+	}
+
+	base := strings.TrimSuffix(prefix, ".") + "." + deviceID
+	return DeviceURIs{
+		ProcedureAcceptOffer:     base + ".accept_offer",
+		TopicOffererOnCandidate:  base + ".offerer.on_candidate",
+		TopicAnswererOnCandidate: base + ".answerer.on_candidate",
+	}, nil
+}
+
+// AcceptOffers runs Setup with config's procedure and topics replaced by the
+// device's URIs (see NewDeviceURIs), so that a backend can make offers to this
+// device with OfferDevice.
+func (r *WebRTCProvider) AcceptOffers(config *ProviderConfig, prefix, deviceID string) error {
+	if config == nil {
+		return fmt.Errorf("provider config is nil")
+	}
+
+	uris, err := NewDeviceURIs(prefix, deviceID)
+	if err != nil {
+		return err
+	}
+
+	cfg := *config
+	cfg.ProcedureHandleOffer = uris.ProcedureAcceptOffer
+	cfg.TopicHandleRemoteCandidates = uris.TopicAnswererOnCandidate
+	cfg.TopicPublishLocalCandidate = uris.TopicOffererOnCandidate
+
+	return r.Setup(&cfg)
+}
+
+// OfferDevice makes an offer to the device that called
+// WebRTCProvider.AcceptOffers with the same prefix and ID, and joins
+// config.Realm on it. config's procedure and topics are replaced by the
+// device's URIs; candidates default to CandidateDeliveryPerRequest, since
+// several backends may be connecting to the same device at once.
+func OfferDevice(config *ClientConfig, prefix, deviceID string) (*WebRTCSession, error) {
+	if config == nil {
+		return nil, fmt.Errorf("client config is nil")
+	}
+
+	uris, err := NewDeviceURIs(prefix, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *config
+	cfg.ProcedureWebRTCOffer = uris.ProcedureAcceptOffer
+	cfg.TopicAnswererOnCandidate = uris.TopicAnswererOnCandidate
+	cfg.TopicOffererOnCandidate = uris.TopicOffererOnCandidate
+	if cfg.CandidateDelivery == "" {
+		cfg.CandidateDelivery = CandidateDeliveryPerRequest
+	}
+
+	return ConnectWAMP(&cfg)
+}
@@ -0,0 +1,30 @@
+package xconnwebrtc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func TestNewDeviceURIs(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		uris, err := xconnwebrtc.NewDeviceURIs("com.example.devices.", "42")
+		require.NoError(t, err)
+		require.Equal(t, "com.example.devices.42.accept_offer", uris.ProcedureAcceptOffer)
+		require.Equal(t, "com.example.devices.42.offerer.on_candidate", uris.TopicOffererOnCandidate)
+		require.Equal(t, "com.example.devices.42.answerer.on_candidate", uris.TopicAnswererOnCandidate)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := xconnwebrtc.NewDeviceURIs("", "42")
+		require.Error(t, err)
+
+		_, err = xconnwebrtc.NewDeviceURIs("com.example.devices", "")
+		require.Error(t, err)
+
+		_, err = xconnwebrtc.NewDeviceURIs("com.example.devices", "a.b")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,254 @@
+package xconnwebrtc
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// sessionGroup is the WAMP sessions a client opened on one PeerConnection:
+// the first one and every one opened through its WebRTCSession.OpenSession.
+type sessionGroup struct {
+	sessions []*WebRTCSession
+
+	sync.Mutex
+}
+
+func newSessionGroup(session *WebRTCSession) *sessionGroup {
+	group := &sessionGroup{}
+	group.add(session)
+	return group
+}
+
+func (g *sessionGroup) add(session *WebRTCSession) {
+	g.Lock()
+	defer g.Unlock()
+
+	session.group = g
+	g.sessions = append(g.sessions, session)
+}
+
+// open returns the group's sessions whose DataChannel is still open, pruning
+// closed ones.
+func (g *sessionGroup) open() []*WebRTCSession {
+	g.Lock()
+	defer g.Unlock()
+
+	g.sessions = slices.DeleteFunc(g.sessions, func(session *WebRTCSession) bool {
+		return session.channel.ReadyState() != webrtc.DataChannelStateOpen
+	})
+	return slices.Clone(g.sessions)
+}
+
+// Diagnostics is a snapshot of the state of a WebRTCSession's PeerConnection
+// and its DataChannels, see WebRTCSession.Diagnostics. Durations are
+// nanoseconds in JSON.
+type Diagnostics struct {
+	Time      time.Time `json:"time"`
+	SessionID uint64    `json:"session_id"`
+	PeerState string    `json:"peer_state"`
+	ICEState  string    `json:"ice_state"`
+	// SelectedPair is nil until ICE selected a candidate pair.
+	SelectedPair *CandidatePairDiagnostics `json:"selected_pair,omitempty"`
+	DTLS         DTLSDiagnostics           `json:"dtls"`
+	SCTP         SCTPDiagnostics           `json:"sctp"`
+	DataChannels []DataChannelDiagnostics  `json:"data_channels"`
+	// Sessions is the number of open WAMP sessions on the connection opened
+	// through this session or its siblings (see WebRTCSession.OpenSession).
+	Sessions int `json:"sessions"`
+}
+
+// CandidateDiagnostics describes one side of the selected candidate pair.
+type CandidateDiagnostics struct {
+	// Type is host, srflx, prflx or relay.
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int32  `json:"port"`
+	// RelayProtocol and URL are set for local relay candidates: the protocol
+	// to the TURN server and the server's URL.
+	RelayProtocol string `json:"relay_protocol,omitempty"`
+	URL           string `json:"url,omitempty"`
+}
+
+// CandidatePairDiagnostics describes the candidate pair ICE selected.
+type CandidatePairDiagnostics struct {
+	Local  CandidateDiagnostics `json:"local"`
+	Remote CandidateDiagnostics `json:"remote"`
+	// Relayed reports whether the path runs through a TURN server.
+	Relayed bool `json:"relayed"`
+	// RTT is the latest STUN round trip time on the pair.
+	RTT           time.Duration `json:"rtt"`
+	BytesSent     uint64        `json:"bytes_sent"`
+	BytesReceived uint64        `json:"bytes_received"`
+	// RequestsSent and ResponsesReceived count STUN connectivity and consent
+	// checks; CheckLoss is the share left unanswered, the closest to a packet
+	// loss rate a DataChannel-only connection reports.
+	RequestsSent      uint64  `json:"requests_sent"`
+	ResponsesReceived uint64  `json:"responses_received"`
+	CheckLoss         float64 `json:"check_loss"`
+}
+
+// DTLSDiagnostics describes the DTLS transport.
+type DTLSDiagnostics struct {
+	State string `json:"state"`
+	// Cipher is the negotiated cipher suite, if pion reports it.
+	Cipher string `json:"cipher,omitempty"`
+	// RemoteFingerprint is the SHA-256 fingerprint of the remote certificate
+	// in lowercase hex, see ClientConfig.PinnedFingerprints.
+	RemoteFingerprint string `json:"remote_fingerprint,omitempty"`
+}
+
+// SCTPDiagnostics describes the SCTP association every DataChannel shares.
+type SCTPDiagnostics struct {
+	State string `json:"state"`
+	// BufferedAmount is the bytes queued for sending across all channels.
+	BufferedAmount   int           `json:"buffered_amount"`
+	SmoothedRTT      time.Duration `json:"smoothed_rtt"`
+	CongestionWindow uint32        `json:"congestion_window"`
+	ReceiverWindow   uint32        `json:"receiver_window"`
+	MTU              uint32        `json:"mtu"`
+	UnackedData      uint32        `json:"unacked_data"`
+	BytesSent        uint64        `json:"bytes_sent"`
+	BytesReceived    uint64        `json:"bytes_received"`
+}
+
+// DataChannelDiagnostics describes one DataChannel, WAMP or raw.
+type DataChannelDiagnostics struct {
+	ID       int32  `json:"id"`
+	Label    string `json:"label"`
+	Protocol string `json:"protocol,omitempty"`
+	State    string `json:"state"`
+	// SessionID is the WAMP session on the channel, if it's this session or
+	// a sibling; BufferedAmount is then the bytes queued for sending on it,
+	// which stays high while the channel is congested.
+	SessionID        uint64 `json:"session_id,omitempty"`
+	BufferedAmount   uint64 `json:"buffered_amount"`
+	MessagesSent     uint32 `json:"messages_sent"`
+	MessagesReceived uint32 `json:"messages_received"`
+	BytesSent        uint64 `json:"bytes_sent"`
+	BytesReceived    uint64 `json:"bytes_received"`
+}
+
+// JSON returns d as indented JSON, e.g. for attaching to support tickets.
+func (d *Diagnostics) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Diagnostics returns a snapshot of the session's PeerConnection: the
+// selected candidate pair, DTLS and SCTP state and per-DataChannel traffic.
+func (w *WebRTCSession) Diagnostics() *Diagnostics {
+	connection := w.connection
+	report := connection.GetStats()
+
+	sessions := w.group.open()
+	diagnostics := &Diagnostics{
+		Time:      time.Now(),
+		SessionID: w.ID(),
+		PeerState: connection.ConnectionState().String(),
+		ICEState:  connection.ICEConnectionState().String(),
+		Sessions:  len(sessions),
+	}
+
+	dtls := connection.SCTP().Transport()
+	diagnostics.DTLS = DTLSDiagnostics{
+		State:             dtls.State().String(),
+		RemoteFingerprint: derFingerprint(dtls.GetRemoteCertificate()),
+	}
+	diagnostics.SCTP = SCTPDiagnostics{
+		State:          connection.SCTP().State().String(),
+		BufferedAmount: connection.SCTP().BufferedAmount(),
+	}
+
+	if pair, ok := dtls.ICETransport().GetSelectedCandidatePairStats(); ok {
+		diagnostics.SelectedPair = selectedPairDiagnostics(report, pair)
+	}
+
+	// Keyed by DataChannel ID.
+	bySessionChannel := make(map[int32]*WebRTCSession, len(sessions))
+	for _, session := range sessions {
+		if id := session.channel.ID(); id != nil {
+			bySessionChannel[int32(*id)] = session
+		}
+	}
+
+	for _, stats := range report {
+		switch stats := stats.(type) {
+		case webrtc.TransportStats:
+			diagnostics.DTLS.Cipher = stats.DTLSCipher
+		case webrtc.SCTPTransportStats:
+			diagnostics.SCTP.SmoothedRTT = secondsToDuration(stats.SmoothedRoundTripTime)
+			diagnostics.SCTP.CongestionWindow = stats.CongestionWindow
+			diagnostics.SCTP.ReceiverWindow = stats.ReceiverWindow
+			diagnostics.SCTP.MTU = stats.MTU
+			diagnostics.SCTP.UnackedData = stats.UNACKData
+			diagnostics.SCTP.BytesSent = stats.BytesSent
+			diagnostics.SCTP.BytesReceived = stats.BytesReceived
+		case webrtc.DataChannelStats:
+			channel := DataChannelDiagnostics{
+				ID:               stats.DataChannelIdentifier,
+				Label:            stats.Label,
+				Protocol:         stats.Protocol,
+				State:            stats.State.String(),
+				MessagesSent:     stats.MessagesSent,
+				MessagesReceived: stats.MessagesReceived,
+				BytesSent:        stats.BytesSent,
+				BytesReceived:    stats.BytesReceived,
+			}
+			if session, ok := bySessionChannel[stats.DataChannelIdentifier]; ok {
+				channel.SessionID = session.ID()
+				channel.BufferedAmount = session.channel.BufferedAmount()
+			}
+			diagnostics.DataChannels = append(diagnostics.DataChannels, channel)
+		default:
+		}
+	}
+
+	slices.SortFunc(diagnostics.DataChannels, func(a, b DataChannelDiagnostics) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return diagnostics
+}
+
+func selectedPairDiagnostics(report webrtc.StatsReport, pair webrtc.ICECandidatePairStats) *CandidatePairDiagnostics {
+	diagnostics := &CandidatePairDiagnostics{
+		RTT:               secondsToDuration(pair.CurrentRoundTripTime),
+		BytesSent:         pair.BytesSent,
+		BytesReceived:     pair.BytesReceived,
+		RequestsSent:      pair.RequestsSent + pair.ConsentRequestsSent,
+		ResponsesReceived: pair.ResponsesReceived,
+	}
+	if diagnostics.RequestsSent > 0 && diagnostics.ResponsesReceived <= diagnostics.RequestsSent {
+		diagnostics.CheckLoss = 1 - float64(diagnostics.ResponsesReceived)/float64(diagnostics.RequestsSent)
+	}
+
+	if local, ok := report[pair.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+		diagnostics.Local = candidateDiagnostics(local)
+	}
+	if remote, ok := report[pair.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+		diagnostics.Remote = candidateDiagnostics(remote)
+	}
+	diagnostics.Relayed = diagnostics.Local.Type == webrtc.ICECandidateTypeRelay.String() ||
+		diagnostics.Remote.Type == webrtc.ICECandidateTypeRelay.String()
+
+	return diagnostics
+}
+
+func candidateDiagnostics(stats webrtc.ICECandidateStats) CandidateDiagnostics {
+	return CandidateDiagnostics{
+		Type:          stats.CandidateType.String(),
+		Protocol:      stats.Protocol,
+		Address:       stats.IP,
+		Port:          stats.Port,
+		RelayProtocol: stats.RelayProtocol,
+		URL:           stats.URL,
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,114 @@
+package xconnwebrtc_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// newLoopbackConnections connects two in-process PeerConnections over
+// loopback and returns them, the offerer first, along with both ends of the
+// DataChannel they were connected with.
+func newLoopbackConnections(t *testing.T) (*webrtc.PeerConnection, *webrtc.PeerConnection,
+	*webrtc.DataChannel, *webrtc.DataChannel) {
+	settings := webrtc.SettingEngine{}
+	settings.SetIncludeLoopbackCandidate(true)
+	settings.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(settings))
+
+	offerer, err := api.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = offerer.Close() })
+	answerer, err := api.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = answerer.Close() })
+
+	local, err := offerer.CreateDataChannel("data", nil)
+	require.NoError(t, err)
+	localOpen := make(chan struct{})
+	local.OnOpen(func() { close(localOpen) })
+
+	remoteCh := make(chan *webrtc.DataChannel, 1)
+	answerer.OnDataChannel(func(channel *webrtc.DataChannel) {
+		channel.OnOpen(func() { remoteCh <- channel })
+	})
+
+	offer, err := offerer.CreateOffer(nil)
+	require.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(offerer)
+	require.NoError(t, offerer.SetLocalDescription(offer))
+	<-gathered
+	require.NoError(t, answerer.SetRemoteDescription(*offerer.LocalDescription()))
+
+	answer, err := answerer.CreateAnswer(nil)
+	require.NoError(t, err)
+	gathered = webrtc.GatheringCompletePromise(answerer)
+	require.NoError(t, answerer.SetLocalDescription(answer))
+	<-gathered
+	require.NoError(t, offerer.SetRemoteDescription(*answerer.LocalDescription()))
+
+	var remote *webrtc.DataChannel
+	select {
+	case remote = <-remoteCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("data channel didn't open")
+	}
+	<-localOpen
+	return offerer, answerer, local, remote
+}
+
+func TestDiagnostics(t *testing.T) {
+	offerer, answerer, _, _ := newLoopbackConnections(t)
+
+	local, err := xconnwebrtc.NewLocalRouter("realm1")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = local.Close() })
+	require.NoError(t, xconnwebrtc.HostRealm(answerer, local, xconnwebrtc.NewOpenAuthenticator()))
+
+	first, err := xconnwebrtc.OpenSession(offerer, "realm1", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = first.Close() })
+	second, err := first.OpenSession("realm1", nil)
+	require.NoError(t, err)
+
+	diagnostics := first.Diagnostics()
+	require.Equal(t, first.ID(), diagnostics.SessionID)
+	require.Equal(t, 2, diagnostics.Sessions)
+	require.Equal(t, "connected", diagnostics.PeerState)
+	require.NotNil(t, diagnostics.SelectedPair)
+	require.Regexp(t, "^([0-9a-f]{2}:){31}[0-9a-f]{2}$", diagnostics.DTLS.RemoteFingerprint)
+
+	// The channel the connections were set up with, and one per session.
+	require.Len(t, diagnostics.DataChannels, 3)
+	sessionIDs := make([]uint64, 0, len(diagnostics.DataChannels))
+	for _, channel := range diagnostics.DataChannels {
+		sessionIDs = append(sessionIDs, channel.SessionID)
+	}
+	require.ElementsMatch(t, []uint64{0, first.ID(), second.ID()}, sessionIDs)
+
+	data, err := diagnostics.JSON()
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	for _, key := range []string{
+		"time", "session_id", "peer_state", "ice_state", "selected_pair", "dtls", "sctp", "data_channels",
+		"sessions",
+	} {
+		require.Contains(t, decoded, key)
+	}
+	require.Contains(t, decoded["dtls"], "remote_fingerprint")
+	require.Contains(t, decoded["selected_pair"], "local")
+	require.Contains(t, decoded["sctp"], "smoothed_rtt")
+	require.Len(t, decoded["data_channels"], 3)
+	require.EqualValues(t, 2, decoded["sessions"])
+
+	require.NoError(t, second.Close())
+	require.Equal(t, 1, first.Diagnostics().Sessions)
+}
@@ -0,0 +1,365 @@
+package xconnwebrtc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/wampproto-go/transports"
+)
+
+const (
+	// e2eMagic starts every key exchange message; it can't be confused with
+	// a WAMP handshake, which starts with transports.MAGIC.
+	e2eMagic   = "XE2E"
+	e2eVersion = 1
+
+	e2eRoleClient byte = 'c'
+	e2eRoleServer byte = 's'
+
+	// e2eHelloSize is magic, version, role, ephemeral X25519 key and
+	// cryptosign public key. The server's hello is followed by its signature,
+	// e2eReplySize in total; the client's confirm message is magic, version,
+	// role and its signature.
+	e2eHelloSize   = 4 + 1 + 1 + 32 + ed25519.PublicKeySize
+	e2eReplySize   = e2eHelloSize + ed25519.SignatureSize
+	e2eConfirmSize = 4 + 1 + 1 + ed25519.SignatureSize
+)
+
+// ErrPeerKeyRejected is returned when the remote side of an encrypted session
+// proves a cryptosign key that isn't in EncryptionConfig.PeerKeys.
+var ErrPeerKeyRejected = errors.New("remote cryptosign key is not trusted")
+
+// EncryptionConfig enables encryption of a WAMP session inside its
+// DataChannel, between the two WAMP endpoints of the channel: the client and
+// the provider (or the WebRTCSession hosting a realm) that accepts its
+// session. Right after the magic-byte handshake, both sides exchange
+// ephemeral X25519 keys, each signing the whole exchange — both ephemeral and
+// cryptosign keys, the protocol version and the negotiated serializer — with
+// its cryptosign (Ed25519) key, and derive one AES-256-GCM key per direction; every WAMP message is then sealed before
+// WebRTCMessageAssembler chunks it. A node that merely forwards DataChannel
+// messages between the two sides only ever sees ciphertext. Both sides must
+// enable it: an encrypted side rejects a plaintext peer and vice versa.
+//
+// The accepting side decrypts every message to route it, so the router
+// behind it sees plaintext. A proxying provider (ProviderConfig.Upstream)
+// would have to forward plaintext upstream and therefore rejects Encryption.
+type EncryptionConfig struct {
+	// PrivateKey is this side's cryptosign key.
+	PrivateKey ed25519.PrivateKey
+	// PeerKeys are the cryptosign public keys the remote side may prove; any
+	// other key fails the exchange with ErrPeerKeyRejected.
+	PeerKeys []ed25519.PublicKey
+}
+
+func (c *EncryptionConfig) validate() error {
+	if len(c.PrivateKey) != ed25519.PrivateKeySize {
+		return fmt.Errorf("encryption private key must be %d bytes", ed25519.PrivateKeySize)
+	}
+	if len(c.PeerKeys) == 0 {
+		return fmt.Errorf("encryption peer keys must not be empty")
+	}
+	for _, key := range c.PeerKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("encryption peer key must be %d bytes", ed25519.PublicKeySize)
+		}
+	}
+	return nil
+}
+
+// e2eExchange is one side of a key exchange in progress.
+type e2eExchange struct {
+	config     *EncryptionConfig
+	role       byte
+	serializer transports.Serializer
+	ephemeral  *ecdh.PrivateKey
+
+	// remoteEphemeral and remoteKey are set from the remote side's hello.
+	remoteEphemeral *ecdh.PublicKey
+	remoteKey       ed25519.PublicKey
+}
+
+func newE2EExchange(config *EncryptionConfig, role byte, serializer transports.Serializer) (*e2eExchange, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e2eExchange{config: config, role: role, serializer: serializer, ephemeral: ephemeral}, nil
+}
+
+func (x *e2eExchange) remoteRole() byte {
+	if x.role == e2eRoleClient {
+		return e2eRoleServer
+	}
+	return e2eRoleClient
+}
+
+// header starts each of this side's key exchange messages.
+func (x *e2eExchange) header() []byte {
+	return append([]byte(e2eMagic), e2eVersion, x.role)
+}
+
+// hello returns this side's keys, the start of its first key exchange
+// message.
+func (x *e2eExchange) hello() []byte {
+	msg := make([]byte, 0, e2eReplySize)
+	msg = append(msg, x.header()...)
+	msg = append(msg, x.ephemeral.PublicKey().Bytes()...)
+	return append(msg, x.config.PrivateKey.Public().(ed25519.PublicKey)...)
+}
+
+// signedData returns what role signs: the transcript of the exchange, so a
+// signature doesn't verify in any other exchange or for the other role.
+func (x *e2eExchange) signedData(role byte) []byte {
+	localKey := x.config.PrivateKey.Public().(ed25519.PublicKey)
+	client := append(x.ephemeral.PublicKey().Bytes(), localKey...)
+	server := append(x.remoteEphemeral.Bytes(), x.remoteKey...)
+	if x.role == e2eRoleServer {
+		client, server = server, client
+	}
+
+	data := fmt.Appendf(nil, "xconn-webrtc-e2e/%d/%c/%d/", e2eVersion, role, x.serializer)
+	data = append(data, client...)
+	return append(data, server...)
+}
+
+// sign returns this side's signature over the transcript; the remote hello
+// must have been received.
+func (x *e2eExchange) sign() []byte {
+	return ed25519.Sign(x.config.PrivateKey, x.signedData(x.role))
+}
+
+// checkHeader checks that remote is a key exchange message of size from the
+// remote side.
+func (x *e2eExchange) checkHeader(remote []byte, size int) error {
+	if len(remote) != size || string(remote[:4]) != e2eMagic {
+		return fmt.Errorf("invalid encryption key exchange message")
+	}
+	if remote[4] != e2eVersion {
+		return fmt.Errorf("unsupported encryption version %d", remote[4])
+	}
+	if remote[5] != x.remoteRole() {
+		return fmt.Errorf("invalid encryption key exchange role %q", remote[5])
+	}
+	return nil
+}
+
+// receiveHello takes the remote side's keys from its hello.
+func (x *e2eExchange) receiveHello(hello []byte) error {
+	remoteKey := ed25519.PublicKey(hello[38:e2eHelloSize])
+	if !slices.ContainsFunc(x.config.PeerKeys, func(key ed25519.PublicKey) bool {
+		return key.Equal(remoteKey)
+	}) {
+		return ErrPeerKeyRejected
+	}
+
+	remoteEphemeral, err := ecdh.X25519().NewPublicKey(hello[6:38])
+	if err != nil {
+		return err
+	}
+
+	x.remoteEphemeral, x.remoteKey = remoteEphemeral, remoteKey
+	return nil
+}
+
+// verify checks the remote side's signature over the transcript.
+func (x *e2eExchange) verify(signature []byte) error {
+	if !ed25519.Verify(x.remoteKey, x.signedData(x.remoteRole()), signature) {
+		return fmt.Errorf("invalid encryption key exchange signature")
+	}
+	return nil
+}
+
+// cipher derives the session's keys once the exchange is verified.
+func (x *e2eExchange) cipher() (*e2eCipher, error) {
+	secret, err := x.ephemeral.ECDH(x.remoteEphemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	clientEphemeral, serverEphemeral := x.ephemeral.PublicKey().Bytes(), x.remoteEphemeral.Bytes()
+	if x.role == e2eRoleServer {
+		clientEphemeral, serverEphemeral = serverEphemeral, clientEphemeral
+	}
+	salt := append(clientEphemeral, serverEphemeral...)
+
+	clientKey, err := e2eAEAD(secret, salt, "client")
+	if err != nil {
+		return nil, err
+	}
+	serverKey, err := e2eAEAD(secret, salt, "server")
+	if err != nil {
+		return nil, err
+	}
+
+	if x.role == e2eRoleClient {
+		return &e2eCipher{send: clientKey, recv: serverKey}, nil
+	}
+	return &e2eCipher{send: serverKey, recv: clientKey}, nil
+}
+
+// finish verifies the server's reply to the client's hello and derives the
+// session's keys, returning the confirm message to send.
+func (x *e2eExchange) finish(reply []byte) (*e2eCipher, []byte, error) {
+	if err := x.checkHeader(reply, e2eReplySize); err != nil {
+		return nil, nil, err
+	}
+	if err := x.receiveHello(reply[:e2eHelloSize]); err != nil {
+		return nil, nil, err
+	}
+	if err := x.verify(reply[e2eHelloSize:]); err != nil {
+		return nil, nil, err
+	}
+
+	c, err := x.cipher()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, append(x.header(), x.sign()...), nil
+}
+
+// confirm verifies the client's confirm message and derives the session's
+// keys.
+func (x *e2eExchange) confirm(msg []byte) (*e2eCipher, error) {
+	if err := x.checkHeader(msg, e2eConfirmSize); err != nil {
+		return nil, err
+	}
+	if err := x.verify(msg[6:]); err != nil {
+		return nil, err
+	}
+	return x.cipher()
+}
+
+func e2eAEAD(secret, salt []byte, direction string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, salt, "xconn-webrtc-e2e "+direction, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// e2eCipher seals and opens the WAMP messages of one encrypted session. Nonces
+// are per-direction message counters, which relies on WAMP channels being
+// ordered and reliable: a dropped, reordered or replayed message fails to
+// open.
+type e2eCipher struct {
+	send, recv cipher.AEAD
+
+	sendMu  sync.Mutex
+	sendSeq uint64
+	recvMu  sync.Mutex
+	recvSeq uint64
+}
+
+func e2eNonce(seq uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+func (c *e2eCipher) seal(plaintext []byte) []byte {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	sealed := c.send.Seal(nil, e2eNonce(c.sendSeq), plaintext, nil)
+	c.sendSeq++
+	return sealed
+}
+
+func (c *e2eCipher) open(sealed []byte) ([]byte, error) {
+	c.recvMu.Lock()
+	defer c.recvMu.Unlock()
+
+	plaintext, err := c.recv.Open(nil, e2eNonce(c.recvSeq), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	c.recvSeq++
+	return plaintext, nil
+}
+
+// exchangeClientKeys performs the client side of the key exchange on a
+// channel that has just completed the magic-byte handshake with serializer:
+// send our hello, verify the server's signed reply and sign the exchange in
+// turn.
+func exchangeClientKeys(channel *webrtc.DataChannel, config *EncryptionConfig, serializer transports.Serializer,
+	timeout time.Duration) (*e2eCipher, error) {
+
+	exchange, err := newE2EExchange(config, e2eRoleClient, serializer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption config: %w", err)
+	}
+
+	respCh := make(chan []byte, 1)
+	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		select {
+		case respCh <- msg.Data:
+		default:
+		}
+	})
+
+	if err = channel.Send(exchange.hello()); err != nil {
+		return nil, fmt.Errorf("failed to send encryption key exchange: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var reply []byte
+	select {
+	case reply = <-respCh:
+	case <-timer.C:
+		return nil, fmt.Errorf("%w waiting for encryption key exchange", ErrTimeout)
+	}
+
+	c, confirm, err := exchange.finish(reply)
+	if err != nil {
+		return nil, err
+	}
+	if err = channel.Send(confirm); err != nil {
+		return nil, fmt.Errorf("failed to send encryption key exchange: %w", err)
+	}
+	return c, nil
+}
+
+// acceptKeys performs the server side of the key exchange given the client's
+// hello, returning the reply to send; the exchange then awaits the client's
+// confirm message.
+func acceptKeys(config *EncryptionConfig, serializer transports.Serializer,
+	clientHello []byte) (*e2eExchange, []byte, error) {
+
+	exchange, err := newE2EExchange(config, e2eRoleServer, serializer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = exchange.checkHeader(clientHello, e2eHelloSize); err != nil {
+		return nil, nil, err
+	}
+	if err = exchange.receiveHello(clientHello); err != nil {
+		return nil, nil, err
+	}
+	return exchange, append(exchange.hello(), exchange.sign()...), nil
+}
@@ -0,0 +1,148 @@
+package xconnwebrtc_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func newEncryptionConfigs(t *testing.T) (*xconnwebrtc.EncryptionConfig, *xconnwebrtc.EncryptionConfig) {
+	clientPublic, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	serverPublic, serverPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	client := &xconnwebrtc.EncryptionConfig{PrivateKey: clientPrivate, PeerKeys: []ed25519.PublicKey{serverPublic}}
+	server := &xconnwebrtc.EncryptionConfig{PrivateKey: serverPrivate, PeerKeys: []ed25519.PublicKey{clientPublic}}
+	return client, server
+}
+
+func TestE2ECipher(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		client, server := newEncryptionConfigs(t)
+		clientCipher, serverCipher, err := xconnwebrtc.ExchangeE2EKeys(client, server)
+		require.NoError(t, err)
+
+		for _, message := range []string{"hello", "", "welcome"} {
+			sealed := clientCipher.Seal([]byte(message))
+			require.NotEqual(t, []byte(message), sealed)
+
+			opened, err := serverCipher.Open(sealed)
+			require.NoError(t, err)
+			require.Equal(t, message, string(opened))
+
+			opened, err = clientCipher.Open(serverCipher.Seal([]byte(message)))
+			require.NoError(t, err)
+			require.Equal(t, message, string(opened))
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		client, server := newEncryptionConfigs(t)
+		clientCipher, serverCipher, err := xconnwebrtc.ExchangeE2EKeys(client, server)
+		require.NoError(t, err)
+
+		sealed := clientCipher.Seal([]byte("call com.example.echo"))
+		sealed[0] ^= 0xff
+		_, err = serverCipher.Open(sealed)
+		require.Error(t, err)
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		client, server := newEncryptionConfigs(t)
+		clientCipher, serverCipher, err := xconnwebrtc.ExchangeE2EKeys(client, server)
+		require.NoError(t, err)
+
+		sealed := clientCipher.Seal([]byte("publish com.example.topic"))
+		_, err = serverCipher.Open(sealed)
+		require.NoError(t, err)
+		_, err = serverCipher.Open(sealed)
+		require.Error(t, err)
+	})
+
+	t.Run("UntrustedKey", func(t *testing.T) {
+		client, server := newEncryptionConfigs(t)
+		other, _ := newEncryptionConfigs(t)
+		server.PeerKeys = other.PeerKeys
+
+		_, _, err := xconnwebrtc.ExchangeE2EKeys(client, server)
+		require.ErrorIs(t, err, xconnwebrtc.ErrPeerKeyRejected)
+	})
+}
+
+// TestE2ETranscript checks that the signatures bind every message to its own
+// exchange: each side signs both ephemeral and cryptosign keys and the
+// negotiated serializer.
+func TestE2ETranscript(t *testing.T) {
+	client, server := newEncryptionConfigs(t)
+
+	t.Run("ReplayedReply", func(t *testing.T) {
+		_, hello, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+		_, reply, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+
+		// A server reply recorded from another exchange.
+		exchange, _, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+		_, _, err = exchange.Finish(reply)
+		require.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("ReplayedConfirm", func(t *testing.T) {
+		exchange, hello, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+		_, reply, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+		_, confirm, err := exchange.Finish(reply)
+		require.NoError(t, err)
+
+		// The recorded client hello and confirm, replayed to a new server
+		// exchange.
+		accepted, _, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+		_, err = accepted.Confirm(confirm)
+		require.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("SwappedEphemeral", func(t *testing.T) {
+		exchange, hello, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+		_, reply, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+
+		// The ephemeral key of another server hello, signature kept.
+		_, other, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+		copy(reply[6:38], other[6:38])
+		_, _, err = exchange.Finish(reply)
+		require.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("SwappedClientHello", func(t *testing.T) {
+		exchange, _, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+
+		// The server answers a hello that isn't the client's.
+		_, other, err := xconnwebrtc.NewE2EClient(client, transports.SerializerCbor)
+		require.NoError(t, err)
+		_, reply, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, other)
+		require.NoError(t, err)
+		_, _, err = exchange.Finish(reply)
+		require.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("SerializerMismatch", func(t *testing.T) {
+		exchange, hello, err := xconnwebrtc.NewE2EClient(client, transports.SerializerJson)
+		require.NoError(t, err)
+		_, reply, err := xconnwebrtc.AcceptE2EKeys(server, transports.SerializerCbor, hello)
+		require.NoError(t, err)
+		_, _, err = exchange.Finish(reply)
+		require.ErrorContains(t, err, "signature")
+	})
+}
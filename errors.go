@@ -0,0 +1,132 @@
+package xconnwebrtc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ConnectPhase is the stage of establishing a WebRTC WAMP session in which a
+// ConnectError happened.
+type ConnectPhase string
+
+const (
+	// PhaseSignaling covers the offer/answer exchange over the signaling
+	// router.
+	PhaseSignaling ConnectPhase = "signaling"
+	// PhaseICE covers connectivity checks until a candidate pair connects.
+	PhaseICE ConnectPhase = "ice"
+	// PhaseDTLS covers the DTLS handshake on the connected candidate pair.
+	PhaseDTLS ConnectPhase = "dtls"
+	// PhaseSCTP covers SCTP association and opening the DataChannel.
+	PhaseSCTP ConnectPhase = "sctp"
+	// PhaseHandshake covers the magic-byte handshake and, with encryption,
+	// the key exchange on the DataChannel.
+	PhaseHandshake ConnectPhase = "handshake"
+	// PhaseJoin covers the WAMP HELLO/WELCOME exchange, authentication
+	// included.
+	PhaseJoin ConnectPhase = "join"
+)
+
+// Sentinel errors matching a ConnectError of the corresponding phase via
+// errors.Is.
+var (
+	ErrSignalingFailed = errors.New("webrtc signaling failed")
+	ErrICEFailed       = errors.New("webrtc ICE failed")
+	ErrDTLSFailed      = errors.New("webrtc DTLS failed")
+	ErrSCTPFailed      = errors.New("webrtc SCTP failed")
+	ErrHandshakeFailed = errors.New("webrtc handshake failed")
+	ErrJoinFailed      = errors.New("webrtc WAMP join failed")
+)
+
+// Sentinel errors describing why a phase failed; found in a ConnectError's
+// chain via errors.Is.
+var (
+	ErrTimeout          = errors.New("timed out")
+	ErrConnectionFailed = errors.New("webrtc connection failed")
+	ErrConnectionClosed = errors.New("webrtc connection closed")
+)
+
+// ConnectError is returned by ConnectWAMP, OfferDevice and
+// WebRTCSession.OpenSession when establishing a session fails. Use
+// errors.Is with a phase sentinel (e.g. ErrICEFailed) or errors.As to
+// inspect it.
+type ConnectError struct {
+	Phase ConnectPhase
+	// Elapsed is the time from the start of the attempt to the failure.
+	Elapsed time.Duration
+	// ICEState and PeerState are the connection's last known states, or zero
+	// if no PeerConnection existed yet.
+	ICEState  webrtc.ICEConnectionState
+	PeerState webrtc.PeerConnectionState
+	Err       error
+}
+
+func newConnectError(phase ConnectPhase, start time.Time, connection *webrtc.PeerConnection,
+	err error) *ConnectError {
+
+	connectErr := &ConnectError{
+		Phase:   phase,
+		Elapsed: time.Since(start),
+		Err:     err,
+	}
+	if connection != nil {
+		connectErr.ICEState = connection.ICEConnectionState()
+		connectErr.PeerState = connection.ConnectionState()
+	}
+	return connectErr
+}
+
+func (e *ConnectError) Error() string {
+	if e.ICEState == webrtc.ICEConnectionStateUnknown {
+		return fmt.Sprintf("webrtc connect failed during %s after %s: %v",
+			e.Phase, e.Elapsed.Round(time.Millisecond), e.Err)
+	}
+	return fmt.Sprintf("webrtc connect failed during %s after %s (ice %s, peer %s): %v",
+		e.Phase, e.Elapsed.Round(time.Millisecond), e.ICEState, e.PeerState, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error of e's phase.
+func (e *ConnectError) Is(target error) bool {
+	switch e.Phase {
+	case PhaseSignaling:
+		return target == ErrSignalingFailed
+	case PhaseICE:
+		return target == ErrICEFailed
+	case PhaseDTLS:
+		return target == ErrDTLSFailed
+	case PhaseSCTP:
+		return target == ErrSCTPFailed
+	case PhaseHandshake:
+		return target == ErrHandshakeFailed
+	case PhaseJoin:
+		return target == ErrJoinFailed
+	default:
+		return false
+	}
+}
+
+// transportPhase returns the transport phase a connection that hasn't opened
+// its DataChannel is stuck in.
+func transportPhase(connection *webrtc.PeerConnection) ConnectPhase {
+	if connection == nil {
+		return PhaseICE
+	}
+
+	switch connection.ICEConnectionState() {
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+	default:
+		return PhaseICE
+	}
+
+	if connection.SCTP().Transport().State() != webrtc.DTLSTransportStateConnected {
+		return PhaseDTLS
+	}
+	return PhaseSCTP
+}
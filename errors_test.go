@@ -0,0 +1,35 @@
+package xconnwebrtc_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func TestConnectError(t *testing.T) {
+	cause := fmt.Errorf("%w waiting for handshake response", xconnwebrtc.ErrTimeout)
+	var err error = &xconnwebrtc.ConnectError{Phase: xconnwebrtc.PhaseHandshake, Err: cause}
+	err = fmt.Errorf("connect: %w", err)
+
+	require.ErrorIs(t, err, xconnwebrtc.ErrHandshakeFailed)
+	require.ErrorIs(t, err, xconnwebrtc.ErrTimeout)
+	require.NotErrorIs(t, err, xconnwebrtc.ErrICEFailed)
+
+	var connectErr *xconnwebrtc.ConnectError
+	require.True(t, errors.As(err, &connectErr))
+	require.Equal(t, xconnwebrtc.PhaseHandshake, connectErr.Phase)
+}
+
+func TestHandshakeError(t *testing.T) {
+	err := fmt.Errorf("open session: %w",
+		&xconnwebrtc.HandshakeError{Code: xconnwebrtc.HandshakeErrorMaxConnectionCount})
+
+	require.ErrorIs(t, err, xconnwebrtc.ErrMaxConnectionCount)
+	require.NotErrorIs(t, err, xconnwebrtc.ErrSerializerUnsupported)
+	require.ErrorIs(t, &xconnwebrtc.HandshakeError{Code: xconnwebrtc.HandshakeErrorSerializerUnsupported},
+		xconnwebrtc.ErrSerializerUnsupported)
+}
@@ -0,0 +1,122 @@
+package xconnwebrtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ConnectionEventType names a step in the life of a WebRTC connection and
+// its WAMP sessions.
+type ConnectionEventType string
+
+const (
+	// EventOfferSent: the client called the provider's offer procedure.
+	EventOfferSent ConnectionEventType = "offer_sent"
+	// EventOfferReceived: the provider received an offer.
+	EventOfferReceived ConnectionEventType = "offer_received"
+	// EventAnswerSent: the provider returned its answer.
+	EventAnswerSent ConnectionEventType = "answer_sent"
+	// EventAnswerReceived: the client applied the provider's answer.
+	EventAnswerReceived ConnectionEventType = "answer_received"
+	// EventCandidateGathered: a local candidate was gathered; an empty
+	// Candidate marks the end of gathering.
+	EventCandidateGathered ConnectionEventType = "candidate_gathered"
+	// EventCandidateSent: a local candidate was trickled over signaling.
+	EventCandidateSent ConnectionEventType = "candidate_sent"
+	// EventCandidateReceived: a remote candidate was added, whether it came
+	// with the SDP or trickled.
+	EventCandidateReceived ConnectionEventType = "candidate_received"
+	// EventICEStateChanged: the ICE connection state changed to ICEState.
+	EventICEStateChanged ConnectionEventType = "ice_state_changed"
+	// EventDTLSConnected: the DTLS handshake completed.
+	EventDTLSConnected ConnectionEventType = "dtls_connected"
+	// EventDataChannelOpened: a DataChannel, WAMP or raw, opened.
+	EventDataChannelOpened ConnectionEventType = "data_channel_opened"
+	// EventHandshakeDone: the magic-byte handshake (and key exchange, with
+	// encryption) completed on a WAMP DataChannel.
+	EventHandshakeDone ConnectionEventType = "handshake_done"
+	// EventJoined: a WAMP session joined as SessionID.
+	EventJoined ConnectionEventType = "joined"
+	// EventSessionClosed: the DataChannel of WAMP session SessionID closed.
+	EventSessionClosed ConnectionEventType = "session_closed"
+	// EventConnectionClosed: the PeerConnection failed or closed, ending
+	// every session on it.
+	EventConnectionClosed ConnectionEventType = "connection_closed"
+)
+
+// ConnectionEvent is one step in the life of a WebRTC connection, reported
+// to ClientConfig.OnEvent and WebRTCProvider.OnEvent. Fields other than
+// Type, Time and RequestID are only set where the event type calls for them.
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	Time time.Time
+	// RequestID identifies the connection's offer. On the client it is only
+	// known from EventAnswerReceived on, unless the offer carried it (see
+	// CandidateDeliveryPerRequest).
+	RequestID string
+	// Candidate is the candidate's SDP attribute for candidate events.
+	Candidate string
+	ICEState  webrtc.ICEConnectionState
+	PeerState webrtc.PeerConnectionState
+	// Label is the DataChannel's label for DataChannel and session events.
+	Label     string
+	SessionID uint64
+}
+
+// emitEvent delivers event to callback, if any, timestamping it.
+func emitEvent(callback func(event ConnectionEvent), event ConnectionEvent) {
+	if callback == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	callback(event)
+}
+
+// eventEmitter stamps the events of one connection with its request ID.
+type eventEmitter struct {
+	callback  func(event ConnectionEvent)
+	requestID string
+
+	sync.Mutex
+}
+
+func newEventEmitter(callback func(event ConnectionEvent), requestID string) *eventEmitter {
+	return &eventEmitter{callback: callback, requestID: requestID}
+}
+
+func (e *eventEmitter) setRequestID(requestID string) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.requestID = requestID
+}
+
+func (e *eventEmitter) emit(event ConnectionEvent) {
+	if e == nil || e.callback == nil {
+		return
+	}
+
+	e.Lock()
+	event.RequestID = e.requestID
+	e.Unlock()
+
+	emitEvent(e.callback, event)
+}
+
+// watchDTLS emits EventDTLSConnected once connection's DTLS handshake
+// completes.
+func watchDTLS(connection *webrtc.PeerConnection, onEvent func(event ConnectionEvent)) {
+	if onEvent == nil {
+		return
+	}
+
+	connection.SCTP().Transport().OnStateChange(func(state webrtc.DTLSTransportState) {
+		if state == webrtc.DTLSTransportStateConnected {
+			emitEvent(onEvent, ConnectionEvent{Type: EventDTLSConnected})
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package xconnwebrtc_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// eventRecorder collects the events of one side of a connection.
+type eventRecorder struct {
+	events []xconnwebrtc.ConnectionEvent
+
+	sync.Mutex
+}
+
+func (r *eventRecorder) record(event xconnwebrtc.ConnectionEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []xconnwebrtc.ConnectionEventType {
+	r.Lock()
+	defer r.Unlock()
+
+	types := make([]xconnwebrtc.ConnectionEventType, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// requireEventOrder waits for want to have been recorded in this order,
+// with any other events in between.
+func requireEventOrder(t *testing.T, recorder *eventRecorder, want ...xconnwebrtc.ConnectionEventType) {
+	t.Helper()
+
+	contains := func() bool {
+		types := recorder.types()
+		for _, typ := range want {
+			i := slices.Index(types, typ)
+			if i < 0 {
+				return false
+			}
+			types = types[i+1:]
+		}
+		return true
+	}
+	require.Eventually(t, contains, 5*time.Second, 10*time.Millisecond, "got %v", recorder.types())
+}
+
+func TestConnectionEvents(t *testing.T) {
+	var client, provider eventRecorder
+	listener, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+	listener.Provider().OnEvent(provider.record)
+	config.OnEvent = client.record
+
+	session, err := xconnwebrtc.ConnectWAMP(config)
+	require.NoError(t, err)
+
+	requireEventOrder(t, &client,
+		xconnwebrtc.EventOfferSent,
+		xconnwebrtc.EventAnswerReceived,
+		xconnwebrtc.EventDTLSConnected,
+		xconnwebrtc.EventDataChannelOpened,
+		xconnwebrtc.EventHandshakeDone,
+		xconnwebrtc.EventJoined,
+	)
+	requireEventOrder(t, &provider,
+		xconnwebrtc.EventOfferReceived,
+		xconnwebrtc.EventAnswerSent,
+		xconnwebrtc.EventDTLSConnected,
+		xconnwebrtc.EventDataChannelOpened,
+		xconnwebrtc.EventHandshakeDone,
+		xconnwebrtc.EventJoined,
+	)
+
+	require.NoError(t, session.Close())
+	requireEventOrder(t, &client, xconnwebrtc.EventJoined, xconnwebrtc.EventSessionClosed)
+	requireEventOrder(t, &provider, xconnwebrtc.EventJoined, xconnwebrtc.EventSessionClosed)
+
+	require.NoError(t, session.Connection().Close())
+	require.NoError(t, listener.Close())
+	requireEventOrder(t, &client, xconnwebrtc.EventSessionClosed, xconnwebrtc.EventConnectionClosed)
+	requireEventOrder(t, &provider, xconnwebrtc.EventSessionClosed, xconnwebrtc.EventConnectionClosed)
+
+	// Every event of the connection carries its request ID once known.
+	client.Lock()
+	defer client.Unlock()
+	requestID := client.events[len(client.events)-1].RequestID
+	require.NotEmpty(t, requestID)
+	provider.Lock()
+	defer provider.Unlock()
+	for _, event := range provider.events {
+		require.Equal(t, requestID, event.RequestID, event.Type)
+	}
+}
@@ -0,0 +1,209 @@
+package xconnwebrtc
+
+import (
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+)
+
+var NewPeerConnection = newPeerConnection
+
+// CandidateBatcher exposes candidateBatcher to the tests.
+type CandidateBatcher = candidateBatcher
+
+// NewCandidateBatcher is newCandidateBatcher with TrickleModeFull waiting at
+// most gatheringTimeout.
+func NewCandidateBatcher(mode TrickleMode, cutoff, gatheringTimeout time.Duration) *CandidateBatcher {
+	b := newCandidateBatcher(mode, cutoff)
+	b.gatherDeadline = time.Now().Add(gatheringTimeout)
+	return b
+}
+
+func (b *candidateBatcher) Add(candidate *webrtc.ICECandidate) bool {
+	return b.add(candidate)
+}
+
+func (b *candidateBatcher) Complete() bool {
+	return b.complete()
+}
+
+func (b *candidateBatcher) Wait() []webrtc.ICECandidateInit {
+	return b.wait()
+}
+
+var ValidateRemoteCandidate = validateRemoteCandidate
+
+// RouteOffer claims the request ID of offer as answering it does.
+func (r *WebRTCProvider) RouteOffer(offer Offer) (string, error) {
+	return r.routeOffer(offer, nil)
+}
+
+var (
+	NewPipePeers    = newPipePeers
+	ProxyWAMPClient = proxyWAMPClient
+)
+
+// ResolveRealm runs resolver for a HELLO to realm, with router and
+// authenticator as the provider's defaults, returning where it goes.
+func ResolveRealm(resolver RealmResolver, realm string, router *xconn.Router,
+	authenticator auth.ServerAuthenticator) (*xconn.Router, auth.ServerAuthenticator, string, error) {
+
+	hello := messages.NewHello(realm, "", nil, nil, nil)
+	target, err := resolveRealm(resolver, &RealmRequest{Realm: realm}, realmTarget{
+		router:        router,
+		authenticator: authenticator,
+		hello:         hello,
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return target.router, target.authenticator, target.hello.Realm(), nil
+}
+
+// IssueIdentityTicket issues caller an identity ticket for requestID's
+// connection as answering its offer does, and returns it along with the
+// authenticator of the connection's sessions.
+func (r *WebRTCProvider) IssueIdentityTicket(requestID string, caller CallerDetails,
+	fallback auth.ServerAuthenticator) (string, auth.ServerAuthenticator, error) {
+	ticket, err := r.newIdentityTicket(caller)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.Lock()
+	r.callers[requestID] = caller
+	r.tickets[requestID] = ticket
+	r.Unlock()
+	return ticket.ticket, r.identityAuthenticator(requestID, fallback), nil
+}
+
+// E2ECipher exposes e2eCipher to the tests.
+type E2ECipher = e2eCipher
+
+func (c *e2eCipher) Seal(plaintext []byte) []byte {
+	return c.seal(plaintext)
+}
+
+func (c *e2eCipher) Open(sealed []byte) ([]byte, error) {
+	return c.open(sealed)
+}
+
+// E2EExchange exposes e2eExchange to the tests.
+type E2EExchange = e2eExchange
+
+// NewE2EClient starts the client side of a key exchange and returns its
+// hello.
+func NewE2EClient(config *EncryptionConfig, serializer transports.Serializer) (*E2EExchange, []byte, error) {
+	exchange, err := newE2EExchange(config, e2eRoleClient, serializer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exchange, exchange.hello(), nil
+}
+
+var AcceptE2EKeys = acceptKeys
+
+func (x *e2eExchange) Finish(reply []byte) (*E2ECipher, []byte, error) {
+	return x.finish(reply)
+}
+
+func (x *e2eExchange) Confirm(msg []byte) (*E2ECipher, error) {
+	return x.confirm(msg)
+}
+
+// ExchangeE2EKeys runs the key exchange between a client and a server and
+// returns the ciphers of both sides.
+func ExchangeE2EKeys(client, server *EncryptionConfig) (*E2ECipher, *E2ECipher, error) {
+	exchange, hello, err := NewE2EClient(client, transports.SerializerJson)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accepted, reply, err := acceptKeys(server, transports.SerializerJson, hello)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientCipher, confirm, err := exchange.finish(reply)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverCipher, err := accepted.confirm(confirm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return clientCipher, serverCipher, nil
+}
+
+var LookupSerializer = lookupSerializer
+
+// SaveSerializers returns a function restoring the serializer registry as it
+// is now, for tests registering serializers of their own.
+func SaveSerializers() func() {
+	registeredSerializers.Lock()
+	saved := maps.Clone(registeredSerializers.byID)
+	registeredSerializers.Unlock()
+
+	return func() {
+		registeredSerializers.Lock()
+		registeredSerializers.byID = saved
+		registeredSerializers.Unlock()
+	}
+}
+
+// Configure applies config's answer options as Setup does.
+func (r *WebRTCProvider) Configure(config *ProviderConfig) error {
+	_, err := r.configure(config)
+	return err
+}
+
+// AnswerConfig returns the AnswerConfig an offer would be answered with.
+func (r *WebRTCProvider) AnswerConfig(requestID string) *AnswerConfig {
+	return r.answerConfig(requestID)
+}
+
+// HostRealm serves local's realm on connection as WebRTCSession.HostRealm
+// does.
+func HostRealm(connection *webrtc.PeerConnection, local *LocalRouter, authenticator auth.ServerAuthenticator) error {
+	session := &WebRTCSession{connection: connection, logger: slog.Default()}
+	return session.HostRealm(local, authenticator, nil)
+}
+
+const ChunkPing = chunkPing
+
+var (
+	KeepaliveFrame = keepaliveFrame
+	KeepaliveNonce = keepaliveNonce
+)
+
+// SendClientHandshake performs the client side of the handshake with spec
+// and reports whether keepalive was agreed.
+func SendClientHandshake(channel *webrtc.DataChannel, spec xconn.SerializerSpec) (bool, error) {
+	_, keepalive, err := sendClientHandshake(channel, []xconn.SerializerSpec{spec}, 5*time.Second, slog.Default())
+	return keepalive, err
+}
+
+// AcceptHandshake accepts a WAMP handshake on channel and reports whether
+// keepalive was agreed.
+func AcceptHandshake(channel *webrtc.DataChannel) <-chan bool {
+	agreed := make(chan bool, 1)
+	acceptHandshake(channel, handshakeLimits{}, slog.Default(),
+		func(_ *webrtc.DataChannel, _ serializers.Serializer, _ *e2eCipher, keepalive bool) {
+			agreed <- keepalive
+		}, func(*webrtc.DataChannel, []byte) {})
+	return agreed
+}
+
+// StartKeepalive starts pinging the remote as after a negotiated handshake.
+func (w *WebRTCPeer) StartKeepalive(config *KeepaliveConfig) {
+	w.startKeepalive(config)
+}
@@ -1,7 +1,9 @@
 package xconnwebrtc
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/pion/webrtc/v4"
@@ -11,44 +13,109 @@ import (
 	"github.com/xconnio/xconn-go"
 )
 
-// serializersByRawSocketID resolves a serializers.Serializer from the
-// RawSocket serializer id a handshake negotiates, mirroring xconn-go's
-// internal RawSocket serializer registry.
-var serializersByRawSocketID = map[transports.Serializer]serializers.Serializer{ //nolint:gochecknoglobals
-	transports.SerializerJson:    &serializers.JSONSerializer{},
-	transports.SerializerMsgpack: &serializers.MsgPackSerializer{},
-	transports.SerializerCbor:    &serializers.CBORSerializer{},
+// HandshakeErrorCode is the error code of a RawSocket-style handshake error
+// response.
+type HandshakeErrorCode byte
+
+const (
+	HandshakeErrorSerializerUnsupported HandshakeErrorCode = 1
+	HandshakeErrorMaxLengthUnacceptable HandshakeErrorCode = 2
+	HandshakeErrorReservedBits          HandshakeErrorCode = 3
+	HandshakeErrorMaxConnectionCount    HandshakeErrorCode = 4
+)
+
+// Sentinel errors matching a HandshakeError of the corresponding code via
+// errors.Is.
+var (
+	ErrSerializerUnsupported = errors.New("serializer unsupported")
+	ErrMaxLengthUnacceptable = errors.New("maximum message length unacceptable")
+	ErrReservedBits          = errors.New("use of reserved bits")
+	ErrMaxConnectionCount    = errors.New("maximum connection count reached")
+)
+
+// HandshakeError is a handshake rejected by the remote side with a
+// RawSocket-style error response.
+type HandshakeError struct {
+	Code HandshakeErrorCode
+}
+
+func (e *HandshakeError) sentinel() error {
+	switch e.Code {
+	case HandshakeErrorSerializerUnsupported:
+		return ErrSerializerUnsupported
+	case HandshakeErrorMaxLengthUnacceptable:
+		return ErrMaxLengthUnacceptable
+	case HandshakeErrorReservedBits:
+		return ErrReservedBits
+	case HandshakeErrorMaxConnectionCount:
+		return ErrMaxConnectionCount
+	default:
+		return nil
+	}
+}
+
+func (e *HandshakeError) Error() string {
+	if sentinel := e.sentinel(); sentinel != nil {
+		return "handshake rejected: " + sentinel.Error()
+	}
+	return fmt.Sprintf("handshake rejected with error code %d", e.Code)
+}
+
+// Is matches the sentinel error of e's code.
+func (e *HandshakeError) Is(target error) bool {
+	sentinel := e.sentinel()
+	return sentinel != nil && target == sentinel
 }
 
 func buildHandshake(serializer transports.Serializer) ([]byte, error) {
 	return transports.SendHandshake(transports.NewHandshake(serializer, transports.DefaultMaxMsgSize))
 }
 
-// wampHandshake reports whether data is a 4-byte WAMP RawSocket-style
-// handshake message.
-func wampHandshake(data []byte) (transports.Serializer, bool) {
+// buildHandshakeError returns the RawSocket error response for code.
+func buildHandshakeError(code HandshakeErrorCode) []byte {
+	return []byte{transports.MAGIC, byte(code) << 4, 0, 0}
+}
+
+// wampHandshake parses data if it is a 4-byte WAMP RawSocket-style handshake
+// message.
+func wampHandshake(data []byte) (*transports.Handshake, bool) {
 	if len(data) != 4 || data[0] != transports.MAGIC {
-		return 0, false
+		return nil, false
 	}
 
 	hs, err := transports.ReceiveHandshake(data)
 	if err != nil {
-		return 0, false
+		return nil, false
 	}
 
-	return hs.Serializer(), true
+	return hs, true
+}
+
+// receiveHandshakeResponse parses the server's answer to a handshake, which
+// is either a handshake of its own or an error response.
+func receiveHandshakeResponse(data []byte) error {
+	if len(data) == 4 && data[0] == transports.MAGIC && data[1]&0x0F == 0 {
+		return &HandshakeError{Code: HandshakeErrorCode(data[1] >> 4)}
+	}
+
+	if _, err := transports.ReceiveHandshake(data); err != nil {
+		return fmt.Errorf("failed to parse handshake response: %w", err)
+	}
+	return nil
 }
 
 // sendClientHandshake performs the client side of the magic-byte handshake
 // on an already-open channel: send our handshake, then wait for the
-// server's response before any WAMP traffic flows.
-func sendClientHandshake(channel *webrtc.DataChannel, spec xconn.SerializerSpec, timeout time.Duration) error {
-	reqBytes, err := buildHandshake(transports.Serializer(spec.SerializerID()))
-	if err != nil {
-		return fmt.Errorf("failed to build handshake: %w", err)
-	}
+// server's response before any WAMP traffic flows. specs are tried in order
+// as long as the server answers with HandshakeErrorSerializerUnsupported;
+// the one it accepts is returned. On a channel opened with keepaliveProtocol,
+// a keepalive extension preceding the response reports that the server
+// answers pings.
+func sendClientHandshake(channel *webrtc.DataChannel, specs []xconn.SerializerSpec,
+	timeout time.Duration, logger *slog.Logger) (xconn.SerializerSpec, bool, error) {
 
-	respCh := make(chan []byte, 1)
+	// Room for a keepalive extension and the response it precedes.
+	respCh := make(chan []byte, 2)
 	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
 		select {
 		case respCh <- msg.Data:
@@ -56,20 +123,177 @@ func sendClientHandshake(channel *webrtc.DataChannel, spec xconn.SerializerSpec,
 		}
 	})
 
-	if err = channel.Send(reqBytes); err != nil {
-		return fmt.Errorf("failed to send handshake: %w", err)
-	}
-
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 
-	select {
-	case resp := <-respCh:
-		if _, err = transports.ReceiveHandshake(resp); err != nil {
-			return fmt.Errorf("failed to parse handshake response: %w", err)
+	var err error
+	for _, spec := range specs {
+		var reqBytes []byte
+		reqBytes, err = buildHandshake(transports.Serializer(spec.SerializerID()))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to build handshake: %w", err)
 		}
-		return nil
-	case <-timer.C:
-		return fmt.Errorf("timed out waiting for handshake response")
+
+		if err = channel.Send(reqBytes); err != nil {
+			return nil, false, fmt.Errorf("failed to send handshake: %w", err)
+		}
+
+		var resp []byte
+		keepalive := false
+		for resp == nil {
+			select {
+			case resp = <-respCh:
+			case <-timer.C:
+				return nil, false, fmt.Errorf("%w waiting for handshake response", ErrTimeout)
+			}
+			if channel.Protocol() == keepaliveProtocol && !keepalive && isKeepaliveExtension(resp) {
+				keepalive, resp = true, nil
+			}
+		}
+		err = receiveHandshakeResponse(resp)
+
+		if err == nil {
+			return spec, keepalive, nil
+		}
+		if !errors.Is(err, ErrSerializerUnsupported) {
+			return nil, false, err
+		}
+		logger.Debug("serializer rejected", "serializer", spec.SerializerID(), logKeyLabel, channel.Label())
+	}
+
+	return nil, false, err
+}
+
+// handshakeLimits are the server-side checks a WAMP handshake must pass.
+type handshakeLimits struct {
+	// serializers, if not empty, are the only serializer ids accepted.
+	serializers []transports.Serializer
+	// encryption, if set, requires the end-to-end encryption key exchange.
+	encryption *EncryptionConfig
+	// minMessageSize rejects clients announcing a smaller maximum message
+	// size with HandshakeErrorMaxLengthUnacceptable.
+	minMessageSize int
+	// admit reports whether another WAMP session may open; if it doesn't,
+	// the client gets HandshakeErrorMaxConnectionCount.
+	admit func(channel *webrtc.DataChannel) bool
+}
+
+// acceptHandshake performs the server side of the magic-byte handshake: the
+// channel's first message decides what it is. A WAMP RawSocket-style
+// handshake is answered and the channel handed to onWAMP with the negotiated
+// serializer; anything else is handed to onRaw, first message included. The
+// message handler registered here only decides once: on the WAMP path,
+// newWebRTCPeer replaces it; on the raw path, onRaw must replace it too.
+//
+// A handshake with an unsupported serializer is answered with a RawSocket
+// error response, after which the client may retry with another one; one
+// failing limits is answered with an error response and the channel closed.
+// With limits.encryption set, a WAMP channel's next message must be the
+// client's hello of the key exchange and the one after the reply its confirm
+// message (see EncryptionConfig); onWAMP then gets the session's cipher.
+// Channels that fail the exchange are closed. A client opening the channel
+// with keepaliveProtocol gets the keepalive extension right before the
+// response, and onWAMP learns that keepalive was agreed.
+func acceptHandshake(channel *webrtc.DataChannel, limits handshakeLimits, logger *slog.Logger,
+	onWAMP func(*webrtc.DataChannel, serializers.Serializer, *e2eCipher, bool),
+	onRaw func(*webrtc.DataChannel, []byte)) {
+
+	logger = logger.With(logKeyLabel, channel.Label())
+	detected := false
+	var negotiated serializers.Serializer
+	var negotiatedID transports.Serializer
+	var exchange *e2eExchange
+	keepalive := channel.Protocol() == keepaliveProtocol
+	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if negotiated != nil && exchange == nil {
+			var reply []byte
+			var err error
+			exchange, reply, err = acceptKeys(limits.encryption, negotiatedID, msg.Data)
+			if err != nil {
+				logger.Debug("encryption key exchange failed", "error", err)
+				negotiated = nil
+				_ = channel.Close()
+				return
+			}
+			if err = channel.Send(reply); err != nil {
+				logger.Debug("failed to send encryption key exchange", "error", err)
+				negotiated = nil
+			}
+			return
+		}
+		if negotiated != nil {
+			serializer := negotiated
+			negotiated = nil
+
+			cipher, err := exchange.confirm(msg.Data)
+			if err != nil {
+				logger.Debug("encryption key exchange failed", "error", err)
+				_ = channel.Close()
+				return
+			}
+			onWAMP(channel, serializer, cipher, keepalive)
+			return
+		}
+		if detected {
+			return
+		}
+
+		hs, ok := wampHandshake(msg.Data)
+		if !ok {
+			detected = true
+			onRaw(channel, msg.Data)
+			return
+		}
+
+		serializer, ok := lookupSerializer(hs.Serializer())
+		if !ok || !allowsSerializer(limits.serializers, hs.Serializer()) {
+			// Not detected yet: the client may retry with another serializer.
+			logger.Debug("unsupported serializer in handshake", "serializer", hs.Serializer())
+			if err := channel.Send(buildHandshakeError(HandshakeErrorSerializerUnsupported)); err != nil {
+				logger.Debug("failed to send handshake error", "error", err)
+			}
+			return
+		}
+		detected = true
+
+		if hs.MaxMessageSize() < limits.minMessageSize {
+			rejectHandshake(channel, HandshakeErrorMaxLengthUnacceptable, logger)
+			return
+		}
+		if limits.admit != nil && !limits.admit(channel) {
+			rejectHandshake(channel, HandshakeErrorMaxConnectionCount, logger)
+			return
+		}
+
+		respBytes, err := buildHandshake(hs.Serializer())
+		if err != nil {
+			logger.Debug("failed to build handshake response", "error", err)
+			return
+		}
+		if keepalive {
+			if err = channel.Send(keepaliveExtension()); err != nil {
+				logger.Debug("failed to send keepalive extension", "error", err)
+				return
+			}
+		}
+		if err = channel.Send(respBytes); err != nil {
+			logger.Debug("failed to send handshake response", "error", err)
+			return
+		}
+
+		if limits.encryption != nil {
+			negotiated, negotiatedID = serializer, hs.Serializer()
+			return
+		}
+		onWAMP(channel, serializer, nil, keepalive)
+	})
+}
+
+// rejectHandshake answers a handshake with code and closes the channel.
+func rejectHandshake(channel *webrtc.DataChannel, code HandshakeErrorCode, logger *slog.Logger) {
+	logger.Debug("rejecting handshake", "error", &HandshakeError{Code: code})
+	if err := channel.Send(buildHandshakeError(code)); err != nil {
+		logger.Debug("failed to send handshake error", "error", err)
 	}
+	_ = channel.Close()
 }
@@ -0,0 +1,149 @@
+package xconnwebrtc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/xconnio/wampproto-go/auth"
+)
+
+// DefaultIdentityTicketTTL is how long an identity ticket issued with an
+// OfferResponse stays valid by default.
+const DefaultIdentityTicketTTL = 30 * time.Second
+
+// identityTicket is a one-time ticket binding the first WAMP session on a
+// PeerConnection to the signaling caller that made its offer.
+type identityTicket struct {
+	ticket   string
+	authID   string
+	authRole string
+	expires  time.Time
+}
+
+func newIdentityTicket(caller CallerDetails, ttl time.Duration) (identityTicket, error) {
+	if caller.AuthID == "" || caller.AuthRole == "" {
+		return identityTicket{}, fmt.Errorf("signaling router did not disclose the caller's identity")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return identityTicket{}, err
+	}
+
+	return identityTicket{
+		ticket:   hex.EncodeToString(buf),
+		authID:   caller.AuthID,
+		authRole: caller.AuthRole,
+		expires:  time.Now().Add(ttl),
+	}, nil
+}
+
+// identityAuthenticator authenticates the WAMP sessions of one PeerConnection
+// whose offer was made with ProviderConfig.InheritIdentity: a ticket session
+// redeems the connection's identity ticket, and any other method must still
+// end up with the signaling caller's authid and authrole, so no other
+// identity can join over the connection.
+type identityAuthenticator struct {
+	caller   CallerDetails
+	redeem   func(ticket string) (identityTicket, bool)
+	fallback auth.ServerAuthenticator
+}
+
+func (a *identityAuthenticator) Methods() []auth.Method {
+	methods := []auth.Method{auth.MethodTicket}
+	if a.fallback != nil {
+		for _, method := range a.fallback.Methods() {
+			if !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods
+}
+
+func (a *identityAuthenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	if ticketRequest, ok := request.(*auth.TicketRequest); ok {
+		if ticket, ok := a.redeem(ticketRequest.Ticket()); ok {
+			if request.AuthID() != "" && request.AuthID() != ticket.authID {
+				return nil, fmt.Errorf("authid %q does not match identity ticket", request.AuthID())
+			}
+			return auth.NewResponse(ticket.authID, ticket.authRole, 0)
+		}
+	}
+
+	if a.fallback == nil {
+		return nil, fmt.Errorf("invalid identity ticket")
+	}
+
+	response, err := a.fallback.Authenticate(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.AuthID() != a.caller.AuthID {
+		return nil, fmt.Errorf("authid %q does not match signaling session %q", response.AuthID(), a.caller.AuthID)
+	}
+	if response.AuthRole() != a.caller.AuthRole {
+		return nil, fmt.Errorf("authrole %q does not match signaling session %q", response.AuthRole(),
+			a.caller.AuthRole)
+	}
+	return response, nil
+}
+
+func (r *WebRTCProvider) inheritsIdentity() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.inheritIdentity
+}
+
+// newIdentityTicket creates an identity ticket for caller with the provider's
+// configured TTL.
+func (r *WebRTCProvider) newIdentityTicket(caller CallerDetails) (identityTicket, error) {
+	r.Lock()
+	ttl := r.identityTicketTTL
+	r.Unlock()
+
+	return newIdentityTicket(caller, ttl)
+}
+
+// identityAuthenticator wraps fallback for the sessions of requestID's
+// connection, or returns fallback as is if no identity ticket was issued.
+func (r *WebRTCProvider) identityAuthenticator(requestID string,
+	fallback auth.ServerAuthenticator) auth.ServerAuthenticator {
+
+	r.Lock()
+	_, inherit := r.tickets[requestID]
+	caller := r.callers[requestID]
+	r.Unlock()
+	if !inherit {
+		return fallback
+	}
+
+	return &identityAuthenticator{
+		caller:   caller,
+		fallback: fallback,
+		redeem: func(presented string) (identityTicket, bool) {
+			r.Lock()
+			defer r.Unlock()
+
+			ticket, ok := r.tickets[requestID]
+			if !ok || ticket.ticket == "" || time.Now().After(ticket.expires) {
+				return identityTicket{}, false
+			}
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(ticket.ticket)) != 1 {
+				return identityTicket{}, false
+			}
+
+			// One-time: keep the entry so later sessions on this connection
+			// stay bound to the caller, but the ticket itself is spent.
+			spent := ticket
+			spent.ticket = ""
+			r.tickets[requestID] = spent
+			return ticket, true
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package xconnwebrtc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// anonymousAuthenticator admits anyone under the authid they ask for, in role.
+type anonymousAuthenticator struct {
+	role string
+}
+
+func (a anonymousAuthenticator) Methods() []auth.Method {
+	return []auth.Method{auth.MethodAnonymous}
+}
+
+func (a anonymousAuthenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	return auth.NewResponse(request.AuthID(), a.role, 0)
+}
+
+func newIdentityProvider(t *testing.T, ttl time.Duration) *xconnwebrtc.WebRTCProvider {
+	provider := xconnwebrtc.NewWebRTCHandler()
+	require.NoError(t, provider.Configure(&xconnwebrtc.ProviderConfig{
+		InheritIdentity:   true,
+		IdentityTicketTTL: ttl,
+	}))
+	return provider
+}
+
+func TestIdentityAuthenticator(t *testing.T) {
+	caller := xconnwebrtc.CallerDetails{SessionID: 1, AuthID: "john", AuthRole: "user"}
+	hello := func(authID string) *messages.Hello {
+		return messages.NewHello("realm1", authID, nil, nil, nil)
+	}
+
+	t.Run("RedeemedOnce", func(t *testing.T) {
+		provider := newIdentityProvider(t, time.Minute)
+		ticket, authenticator, err := provider.IssueIdentityTicket("request", caller, nil)
+		require.NoError(t, err)
+
+		response, err := authenticator.Authenticate(auth.NewTicketRequest(hello(""), ticket))
+		require.NoError(t, err)
+		require.Equal(t, "john", response.AuthID())
+		require.Equal(t, "user", response.AuthRole())
+
+		_, err = authenticator.Authenticate(auth.NewTicketRequest(hello(""), ticket))
+		require.Error(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		provider := newIdentityProvider(t, time.Millisecond)
+		ticket, authenticator, err := provider.IssueIdentityTicket("request", caller, nil)
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+		_, err = authenticator.Authenticate(auth.NewTicketRequest(hello(""), ticket))
+		require.Error(t, err)
+	})
+
+	t.Run("AuthIDMismatch", func(t *testing.T) {
+		provider := newIdentityProvider(t, time.Minute)
+		ticket, authenticator, err := provider.IssueIdentityTicket("request", caller, nil)
+		require.NoError(t, err)
+
+		_, err = authenticator.Authenticate(auth.NewTicketRequest(hello("jane"), ticket))
+		require.ErrorContains(t, err, "does not match identity ticket")
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			authID string
+			role   string
+			err    string
+		}{
+			{"SameIdentity", "john", "user", ""},
+			{"AuthIDMismatch", "jane", "user", `authid "jane" does not match`},
+			{"RoleMismatch", "john", "admin", `authrole "admin" does not match`},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				provider := newIdentityProvider(t, time.Minute)
+				_, authenticator, err := provider.IssueIdentityTicket("request", caller,
+					anonymousAuthenticator{role: tt.role})
+				require.NoError(t, err)
+
+				response, err := authenticator.Authenticate(auth.NewRequest(hello(tt.authID), auth.MethodAnonymous))
+				if tt.err != "" {
+					require.ErrorContains(t, err, tt.err)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tt.authID, response.AuthID())
+				require.Equal(t, tt.role, response.AuthRole())
+			})
+		}
+	})
+}
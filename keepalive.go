@@ -0,0 +1,193 @@
+package xconnwebrtc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultKeepaliveInterval = 15 * time.Second
+	DefaultKeepaliveTimeout  = 10 * time.Second
+
+	// keepaliveProtocol is the DataChannel protocol with which the side
+	// opening a WAMP channel with KeepaliveConfig asks for keepalive; it
+	// answers pings either way. Peers predating keepalive leave the protocol
+	// empty, or set it to a WAMP subprotocol.
+	keepaliveProtocol = "xconn.keepalive"
+	// keepaliveMagic starts the keepalive handshake extension: the accepting
+	// side of a channel opened with keepaliveProtocol sends it right before
+	// its successful handshake response, announcing that it answers pings
+	// too. Like e2eMagic, it can't be confused with a handshake response.
+	keepaliveMagic   = "XKAL"
+	keepaliveVersion = 1
+)
+
+// KeepaliveConfig enables application-level ping/pong on a WAMP DataChannel,
+// detecting a remote process that stopped serving the channel while ICE
+// still considers the connection alive. Every Interval a ping goes out; a
+// pong not back within Timeout closes the channel, and with it the session.
+// Each pong updates the measured round-trip time, see WebRTCSession.RTT.
+//
+// Pings and pongs are DataChannel messages of their own whose header byte is
+// 2 or 3 instead of the 0/1 chunk flag of WebRTCMessageAssembler, so WAMP
+// payloads are untouched. They are not encrypted: they only carry a random
+// nonce. Every WebRTCPeer answers pings whether or not it sends its own, but
+// peers predating keepalive would misread them as message chunks, so support
+// is negotiated in each channel's magic-byte handshake and pings only go to
+// peers that agreed to it; towards others, KeepaliveConfig has no effect.
+type KeepaliveConfig struct {
+	// Interval between pings. Defaults to DefaultKeepaliveInterval.
+	Interval time.Duration
+	// Timeout for each pong; it also bounds how long a ping may queue
+	// behind large messages. Time the local side spends waiting for the
+	// application to read messages doesn't count, as a pong may be queued
+	// behind them. Defaults to DefaultKeepaliveTimeout.
+	Timeout time.Duration
+}
+
+func (c *KeepaliveConfig) validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("keepalive interval must not be negative")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("keepalive timeout must not be negative")
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultKeepaliveInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultKeepaliveTimeout
+	}
+	return nil
+}
+
+// keepaliveExtension returns the keepalive handshake extension message.
+func keepaliveExtension() []byte {
+	return append([]byte(keepaliveMagic), keepaliveVersion)
+}
+
+// isKeepaliveExtension reports whether data is the keepalive handshake
+// extension message.
+func isKeepaliveExtension(data []byte) bool {
+	return len(data) == len(keepaliveMagic)+1 && string(data[:len(keepaliveMagic)]) == keepaliveMagic &&
+		data[len(keepaliveMagic)] == keepaliveVersion
+}
+
+// keepaliveFrame builds a ping or pong frame carrying nonce.
+func keepaliveFrame(kind byte, nonce uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{kind}, nonce)
+}
+
+// keepaliveNonce returns the nonce of a ping or pong frame.
+func keepaliveNonce(frame []byte) (uint64, bool) {
+	if len(frame) != 9 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(frame[1:]), true
+}
+
+// handleKeepalive answers a ping frame or delivers a pong's nonce, reporting
+// whether data was a keepalive frame at all.
+func (w *WebRTCPeer) handleKeepalive(data []byte) bool {
+	if len(data) == 0 || (data[0] != chunkPing && data[0] != chunkPong) {
+		return false
+	}
+
+	nonce, ok := keepaliveNonce(data)
+	if !ok {
+		w.logger.Debug("dropping malformed keepalive frame", "length", len(data))
+		return true
+	}
+
+	if data[0] == chunkPing {
+		if err := w.channel.Send(keepaliveFrame(chunkPong, nonce)); err != nil {
+			w.logger.Debug("failed to send keepalive pong", "error", err)
+		}
+		return true
+	}
+
+	select {
+	case w.pongs <- nonce:
+	default:
+	}
+	return true
+}
+
+// startKeepalive starts pinging the remote, if config is set.
+func (w *WebRTCPeer) startKeepalive(config *KeepaliveConfig) {
+	if config != nil {
+		go w.keepalive(*config)
+	}
+}
+
+// keepalive pings the remote every config.Interval until the peer closes,
+// closing it if a pong doesn't come back within config.Timeout.
+func (w *WebRTCPeer) keepalive(config KeepaliveConfig) {
+	interval := time.NewTicker(config.Interval)
+	defer interval.Stop()
+
+	for {
+		select {
+		case <-interval.C:
+		case <-w.done:
+			return
+		}
+
+		var buf [8]byte
+		_, _ = rand.Read(buf[:])
+		nonce := binary.BigEndian.Uint64(buf[:])
+
+		sent := time.Now()
+		if err := w.channel.Send(keepaliveFrame(chunkPing, nonce)); err != nil {
+			w.logger.Debug("failed to send keepalive ping", "error", err)
+			_ = w.Close()
+			return
+		}
+
+		if !w.awaitPong(nonce, config.Timeout) {
+			select {
+			case <-w.done:
+			default:
+				w.logger.Debug("keepalive timed out, closing channel", "timeout", config.Timeout)
+				_ = w.Close()
+			}
+			return
+		}
+		w.rtt.Store(int64(time.Since(sent)))
+	}
+}
+
+// awaitPong waits up to timeout for the pong of nonce, skipping any other.
+// The timeout is extended by any backpressure in the meantime: the pong
+// can't be handled before the messages ahead of it are read.
+func (w *WebRTCPeer) awaitPong(nonce uint64, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	stalled := w.backpressure()
+	for {
+		select {
+		case received := <-w.pongs:
+			if received == nonce {
+				return true
+			}
+		case <-timer.C:
+			if now := w.backpressure(); now > stalled {
+				timer.Reset(now - stalled)
+				stalled = now
+				continue
+			}
+			return false
+		case <-w.done:
+			return false
+		}
+	}
+}
+
+// RTT returns the round-trip time measured by the latest keepalive ping, or
+// zero before the first pong or without KeepaliveConfig.
+func (w *WebRTCPeer) RTT() time.Duration {
+	return time.Duration(w.rtt.Load())
+}
@@ -0,0 +1,175 @@
+package xconnwebrtc_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// newLoopbackChannels connects two in-process PeerConnections over loopback
+// and returns both ends of one open DataChannel, the offerer's first.
+func newLoopbackChannels(t *testing.T) (*webrtc.DataChannel, *webrtc.DataChannel) {
+	_, _, local, remote := newLoopbackConnections(t)
+	return local, remote
+}
+
+func TestKeepaliveFrame(t *testing.T) {
+	frame := xconnwebrtc.KeepaliveFrame(xconnwebrtc.ChunkPing, 0x0102030405060708)
+	require.Equal(t, []byte{xconnwebrtc.ChunkPing, 1, 2, 3, 4, 5, 6, 7, 8}, frame)
+
+	nonce, ok := xconnwebrtc.KeepaliveNonce(frame)
+	require.True(t, ok)
+	require.Equal(t, uint64(0x0102030405060708), nonce)
+
+	_, ok = xconnwebrtc.KeepaliveNonce(frame[:8])
+	require.False(t, ok)
+	_, ok = xconnwebrtc.KeepaliveNonce(append(frame, 0))
+	require.False(t, ok)
+}
+
+// openChannel opens another DataChannel between two connected
+// PeerConnections and returns both of its ends.
+func openChannel(t *testing.T, offerer, answerer *webrtc.PeerConnection,
+	options *webrtc.DataChannelInit) (*webrtc.DataChannel, *webrtc.DataChannel) {
+	remoteCh := make(chan *webrtc.DataChannel, 1)
+	answerer.OnDataChannel(func(channel *webrtc.DataChannel) {
+		channel.OnOpen(func() { remoteCh <- channel })
+	})
+
+	local, err := offerer.CreateDataChannel("wamp", options)
+	require.NoError(t, err)
+	localOpen := make(chan struct{})
+	local.OnOpen(func() { close(localOpen) })
+
+	select {
+	case remote := <-remoteCh:
+		<-localOpen
+		return local, remote
+	case <-time.After(10 * time.Second):
+		t.Fatal("data channel didn't open")
+		return nil, nil
+	}
+}
+
+func TestKeepaliveHandshake(t *testing.T) {
+	offerer, answerer, _, _ := newLoopbackConnections(t)
+	keepalive := "xconn.keepalive"
+
+	t.Run("Agreed", func(t *testing.T) {
+		local, remote := openChannel(t, offerer, answerer, &webrtc.DataChannelInit{Protocol: &keepalive})
+		accepted := xconnwebrtc.AcceptHandshake(remote)
+
+		agreed, err := xconnwebrtc.SendClientHandshake(local, xconn.CBORSerializerSpec)
+		require.NoError(t, err)
+		require.True(t, agreed)
+		require.True(t, <-accepted)
+	})
+
+	t.Run("NotRequested", func(t *testing.T) {
+		local, remote := openChannel(t, offerer, answerer, nil)
+		accepted := xconnwebrtc.AcceptHandshake(remote)
+		messages := make(chan []byte, 4)
+		local.OnMessage(func(msg webrtc.DataChannelMessage) { messages <- msg.Data })
+
+		request, err := transports.SendHandshake(transports.NewHandshake(transports.SerializerCbor,
+			transports.DefaultMaxMsgSize))
+		require.NoError(t, err)
+		require.NoError(t, local.Send(request))
+
+		// Only the plain handshake response comes back, reserved bytes clear.
+		require.False(t, <-accepted)
+		response := <-messages
+		_, err = transports.ReceiveHandshake(response)
+		require.NoError(t, err)
+		require.Empty(t, messages)
+	})
+
+	t.Run("PeerPredatingKeepalive", func(t *testing.T) {
+		local, remote := openChannel(t, offerer, answerer, &webrtc.DataChannelInit{Protocol: &keepalive})
+		remote.OnMessage(func(msg webrtc.DataChannelMessage) {
+			hs, err := transports.ReceiveHandshake(msg.Data)
+			assert.NoError(t, err)
+			response, err := transports.SendHandshake(hs)
+			assert.NoError(t, err)
+			assert.NoError(t, remote.Send(response))
+		})
+
+		agreed, err := xconnwebrtc.SendClientHandshake(local, xconn.CBORSerializerSpec)
+		require.NoError(t, err)
+		require.False(t, agreed)
+	})
+}
+
+func TestKeepalive(t *testing.T) {
+	config := &xconnwebrtc.KeepaliveConfig{Interval: 20 * time.Millisecond, Timeout: 200 * time.Millisecond}
+
+	t.Run("RTT", func(t *testing.T) {
+		local, remote := newLoopbackChannels(t)
+		peer := xconnwebrtc.NewWebRTCPeer(local).(*xconnwebrtc.WebRTCPeer)
+		defer peer.Close()
+		remotePeer := xconnwebrtc.NewWebRTCPeer(remote)
+		defer remotePeer.Close()
+
+		require.Zero(t, peer.RTT())
+		peer.StartKeepalive(config)
+		require.Eventually(t, func() bool { return peer.RTT() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+		// Pings never surface as messages.
+		require.NoError(t, remotePeer.Write([]byte("hello")))
+		msg, err := peer.Read()
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(msg))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		local, remote := newLoopbackChannels(t)
+		// A peer predating keepalive: it never answers pings.
+		remote.OnMessage(func(webrtc.DataChannelMessage) {})
+
+		peer := xconnwebrtc.NewWebRTCPeer(local).(*xconnwebrtc.WebRTCPeer)
+		peer.StartKeepalive(config)
+
+		read := make(chan error, 1)
+		go func() {
+			_, err := peer.Read()
+			read <- err
+		}()
+		select {
+		case err := <-read:
+			require.ErrorIs(t, err, io.EOF)
+		case <-time.After(5 * time.Second):
+			t.Fatal("keepalive didn't close the peer")
+		}
+	})
+
+	t.Run("Backpressure", func(t *testing.T) {
+		local, remote := newLoopbackChannels(t)
+		peer := xconnwebrtc.NewWebRTCPeer(local).(*xconnwebrtc.WebRTCPeer)
+		defer peer.Close()
+		remotePeer := xconnwebrtc.NewWebRTCPeer(remote)
+		defer remotePeer.Close()
+
+		peer.StartKeepalive(config)
+		for range 3 {
+			require.NoError(t, remotePeer.Write([]byte("queued")))
+		}
+
+		// Not reading for several timeouts stalls the pongs behind the
+		// queued messages, which mustn't count as a dead remote.
+		time.Sleep(5 * config.Timeout)
+		for range 3 {
+			msg, err := peer.Read()
+			require.NoError(t, err)
+			require.Equal(t, "queued", string(msg))
+		}
+		require.Eventually(t, func() bool { return peer.RTT() > 0 }, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,220 @@
+package xconnwebrtc
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/xconn-go"
+)
+
+// errNoLocalAuthenticator rejects serving an embedded realm without an
+// authenticator, so it is only ever open by choice.
+var errNoLocalAuthenticator = errors.New("authenticator must not be nil: use NewOpenAuthenticator to admit everyone")
+
+// localRole is the role every session on an embedded router gets unless a
+// custom authenticator says otherwise; it may call, register, publish and
+// subscribe on any URI.
+const localRole = "peer"
+
+// localAuthenticator admits every session to an embedded router as localRole.
+type localAuthenticator struct{}
+
+// NewOpenAuthenticator returns an authenticator admitting every session
+// anonymously, with full access to the realm of a LocalRouter. An embedded
+// realm is never open by default: pass it explicitly as
+// ProviderConfig.Authenticator, to ListenPeer, LocalRouter.Serve or
+// WebRTCSession.HostRealm to open the realm to whoever connects.
+func NewOpenAuthenticator() auth.ServerAuthenticator {
+	return localAuthenticator{}
+}
+
+func (localAuthenticator) Methods() []auth.Method {
+	return []auth.Method{auth.MethodAnonymous}
+}
+
+func (localAuthenticator) Authenticate(request auth.Request) (auth.Response, error) {
+	return auth.NewResponse(request.AuthID(), localRole, 0)
+}
+
+// newLocalRouter creates a router hosting a single realm on which localRole
+// has full access.
+func newLocalRouter(realm string) (*xconn.Router, error) {
+	router, err := xconn.NewRouter(xconn.DefaultRouterConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = router.AddRealm(realm, &xconn.RealmConfig{
+		Roles: []xconn.RealmRole{
+			{
+				Name: localRole,
+				Permissions: []xconn.Permission{{
+					URI:            "",
+					MatchPolicy:    "prefix",
+					AllowCall:      true,
+					AllowRegister:  true,
+					AllowPublish:   true,
+					AllowSubscribe: true,
+				}},
+			},
+		},
+	}); err != nil {
+		router.Close()
+		return nil, err
+	}
+
+	return router, nil
+}
+
+// LocalRouter is a lightweight router embedded in a WebRTC endpoint, hosting
+// a single realm for WAMP sessions arriving over the endpoint's own
+// PeerConnections, so a device can expose procedures and topics to whoever
+// connects to it without a central router. The endpoint itself takes part in
+// the realm through Session.
+type LocalRouter struct {
+	realm   string
+	router  *xconn.Router
+	session *xconn.Session
+}
+
+// NewLocalRouter creates an embedded router hosting realm and joins it
+// locally. Every session admitted by NewOpenAuthenticator may call, register,
+// publish and subscribe on any URI.
+func NewLocalRouter(realm string) (*LocalRouter, error) {
+	if realm == "" {
+		return nil, fmt.Errorf("realm must not be empty")
+	}
+
+	router, err := newLocalRouter(realm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local router: %w", err)
+	}
+
+	session, err := joinLocal(router, realm)
+	if err != nil {
+		router.Close()
+		return nil, fmt.Errorf("failed to join local realm: %w", err)
+	}
+
+	return &LocalRouter{
+		realm:   realm,
+		router:  router,
+		session: session,
+	}, nil
+}
+
+// Realm returns the realm the router hosts.
+func (l *LocalRouter) Realm() string {
+	return l.realm
+}
+
+// Router returns the underlying router.
+func (l *LocalRouter) Router() *xconn.Router {
+	return l.router
+}
+
+// Session returns the endpoint's own session on the realm.
+func (l *LocalRouter) Session() *xconn.Session {
+	return l.session
+}
+
+// Join opens another in-process session on the router's realm, e.g. for a
+// second client of the same endpoint. Close it with Leave.
+func (l *LocalRouter) Join() (*xconn.Session, error) {
+	return joinLocal(l.router, l.realm)
+}
+
+// Serve runs one WAMP session on peer: HELLO/WELCOME handshake, authenticated
+// by authenticator (see NewOpenAuthenticator), then router attach and message
+// loop until the session ends.
+func (l *LocalRouter) Serve(peer xconn.Peer, serializer serializers.Serializer,
+	authenticator auth.ServerAuthenticator) error {
+
+	if authenticator == nil {
+		_ = peer.Close()
+		return errNoLocalAuthenticator
+	}
+
+	hello, err := xconn.ReadHello(peer, serializer)
+	if err != nil {
+		return err
+	}
+
+	base, err := xconn.Accept(peer, hello, serializer, authenticator)
+	if err != nil {
+		return err
+	}
+
+	return serveRouterClient(l.router, base)
+}
+
+// Close leaves the local session and closes the router, ending every session
+// on it.
+func (l *LocalRouter) Close() error {
+	err := l.session.Leave()
+	l.router.Close()
+	return err
+}
+
+// joinLocal joins realm on router in-process, over an in-memory peer pair.
+func joinLocal(router *xconn.Router, realm string) (*xconn.Session, error) {
+	serializer := &serializers.CBORSerializer{}
+	clientPeer, routerPeer := newPipePeers()
+
+	accepted := make(chan error, 1)
+	go func() {
+		hello, err := xconn.ReadHello(routerPeer, serializer)
+		if err != nil {
+			accepted <- err
+			return
+		}
+
+		base, err := xconn.Accept(routerPeer, hello, serializer, localAuthenticator{})
+		if err != nil {
+			accepted <- err
+			return
+		}
+		accepted <- nil
+
+		if err = serveRouterClient(router, base); err != nil {
+			slog.Default().Debug("local session failed", "realm", realm, "error", err)
+		}
+	}()
+
+	base, err := xconn.Join(clientPeer, realm, serializer, auth.NewAnonymousAuthenticator("", nil))
+	if err != nil {
+		_ = clientPeer.Close()
+		return nil, err
+	}
+
+	if err = <-accepted; err != nil {
+		_ = clientPeer.Close()
+		return nil, err
+	}
+
+	return xconn.NewSession(base, serializer), nil
+}
+
+// serveRouterClient attaches base to router and feeds it every message base
+// receives, until base closes.
+func serveRouterClient(router *xconn.Router, base xconn.BaseSession) error {
+	if err := router.AttachClient(base); err != nil {
+		return fmt.Errorf("failed to attach client %w", err)
+	}
+
+	for {
+		msg, err := base.ReadMessage()
+		if err != nil {
+			_ = router.DetachClient(base)
+			return nil
+		}
+
+		if err = router.ReceiveMessage(base, msg); err != nil {
+			_ = router.DetachClient(base)
+			return fmt.Errorf("failed to receive message: %w", err)
+		}
+	}
+}
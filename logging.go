@@ -0,0 +1,72 @@
+package xconnwebrtc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pion/logging"
+)
+
+// levelTrace is the slog level of pion's trace logs, below slog.LevelDebug.
+const levelTrace = slog.LevelDebug - 4
+
+// Attribute keys shared by every log record of a connection or session.
+const (
+	logKeyRequestID = "request_id"
+	logKeySessionID = "session_id"
+	logKeyLabel     = "label"
+	logKeyScope     = "scope"
+)
+
+// loggerOrDefault returns logger, or slog.Default() if it is nil.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// withRequestID adds the request ID attribute to logger, if requestID is set.
+func withRequestID(logger *slog.Logger, requestID string) *slog.Logger {
+	if requestID == "" {
+		return logger
+	}
+	return logger.With(logKeyRequestID, requestID)
+}
+
+// pionLoggerFactory routes pion's logs into a slog.Logger, with the pion
+// scope (e.g. "ice", "dtls") as an attribute.
+type pionLoggerFactory struct {
+	logger *slog.Logger
+}
+
+func (f pionLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return pionLogger{logger: f.logger.With(logKeyScope, scope)}
+}
+
+type pionLogger struct {
+	logger *slog.Logger
+}
+
+func (l pionLogger) log(level slog.Level, msg string) {
+	l.logger.Log(context.Background(), level, msg)
+}
+
+// logf formats only if level is enabled: pion traces on every packet.
+func (l pionLogger) logf(level slog.Level, format string, args ...any) {
+	if l.logger.Enabled(context.Background(), level) {
+		l.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l pionLogger) Trace(msg string)                  { l.log(levelTrace, msg) }
+func (l pionLogger) Tracef(format string, args ...any) { l.logf(levelTrace, format, args...) }
+func (l pionLogger) Debug(msg string)                  { l.log(slog.LevelDebug, msg) }
+func (l pionLogger) Debugf(format string, args ...any) { l.logf(slog.LevelDebug, format, args...) }
+func (l pionLogger) Info(msg string)                   { l.log(slog.LevelInfo, msg) }
+func (l pionLogger) Infof(format string, args ...any)  { l.logf(slog.LevelInfo, format, args...) }
+func (l pionLogger) Warn(msg string)                   { l.log(slog.LevelWarn, msg) }
+func (l pionLogger) Warnf(format string, args ...any)  { l.logf(slog.LevelWarn, format, args...) }
+func (l pionLogger) Error(msg string)                  { l.log(slog.LevelError, msg) }
+func (l pionLogger) Errorf(format string, args ...any) { l.logf(slog.LevelError, format, args...) }
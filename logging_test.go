@@ -0,0 +1,128 @@
+package xconnwebrtc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// logRecorder collects the records of a JSON slog.Logger.
+type logRecorder struct {
+	buf bytes.Buffer
+
+	sync.Mutex
+}
+
+// newLogRecorder returns a recorder and a logger writing to it at every
+// level, pion's trace logs included.
+func newLogRecorder() (*logRecorder, *slog.Logger) {
+	recorder := &logRecorder{}
+	return recorder, slog.New(slog.NewJSONHandler(recorder, &slog.HandlerOptions{Level: slog.LevelDebug - 4}))
+}
+
+func (r *logRecorder) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.buf.Write(p)
+}
+
+func (r *logRecorder) records(t *testing.T) []map[string]any {
+	r.Lock()
+	defer r.Unlock()
+
+	var records []map[string]any
+	for line := range bytes.Lines(r.buf.Bytes()) {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+// pionRecords returns the records pion logged, which carry its scope.
+func pionRecords(records []map[string]any) []map[string]any {
+	return slices.DeleteFunc(slices.Clone(records), func(record map[string]any) bool {
+		_, ok := record["scope"]
+		return !ok
+	})
+}
+
+func TestLogging(t *testing.T) {
+	offerLogs, offerLogger := newLogRecorder()
+	answerLogs, answerLogger := newLogRecorder()
+
+	offerer := xconnwebrtc.NewOfferer()
+	offer, err := offerer.Offer(&xconnwebrtc.OfferConfig{
+		Ordered:       true,
+		TrickleMode:   xconnwebrtc.TrickleModeFull,
+		RequestID:     "offer-request",
+		SessionID:     42,
+		SettingEngine: loopbackOnly,
+		Logger:        offerLogger,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = offerer.Connection().Close() })
+
+	// The provider hands the Answerer a logger with the request ID.
+	answerer := xconnwebrtc.NewAnswerer()
+	answer, err := answerer.Answer(&xconnwebrtc.AnswerConfig{
+		TrickleMode:   xconnwebrtc.TrickleModeFull,
+		SettingEngine: loopbackOnly,
+		Logger:        answerLogger.With("request_id", "answer-request"),
+	}, *offer, time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = answerer.Connection().Close() })
+	require.NoError(t, offerer.HandleAnswer(*answer))
+
+	var channel *webrtc.DataChannel
+	select {
+	case channel = <-offerer.WaitReady():
+	case <-time.After(10 * time.Second):
+		t.Fatal("data channel didn't open")
+	}
+
+	// A handshake with a serializer no one registered is logged with the
+	// channel's label.
+	handshake, err := transports.SendHandshake(transports.NewHandshake(transports.Serializer(15),
+		transports.DefaultMaxMsgSize))
+	require.NoError(t, err)
+	require.NoError(t, channel.Send(handshake))
+
+	var rejected map[string]any
+	require.Eventually(t, func() bool {
+		records := answerLogs.records(t)
+		i := slices.IndexFunc(records, func(record map[string]any) bool {
+			return record["msg"] == "unsupported serializer in handshake"
+		})
+		if i >= 0 {
+			rejected = records[i]
+		}
+		return i >= 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "data", rejected["label"])
+	require.Equal(t, "answer-request", rejected["request_id"])
+
+	offerRecords := pionRecords(offerLogs.records(t))
+	require.NotEmpty(t, offerRecords)
+	for _, record := range offerRecords {
+		require.Equal(t, "offer-request", record["request_id"], record)
+		require.InDelta(t, 42, record["session_id"], 0, record)
+	}
+
+	answerRecords := pionRecords(answerLogs.records(t))
+	require.NotEmpty(t, answerRecords)
+	for _, record := range answerRecords {
+		require.Equal(t, "answer-request", record["request_id"], record)
+	}
+}
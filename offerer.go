@@ -2,11 +2,11 @@ package xconnwebrtc
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"sync"
-	"time"
 
 	"github.com/pion/webrtc/v4"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/xconn-go"
 )
@@ -19,6 +19,9 @@ type Offerer struct {
 	trickleTopic        string
 	trickleRequestID    string
 	pendingCandidates   []webrtc.ICECandidateInit
+	candidateFilter     CandidateFilter
+	onEvent             func(event ConnectionEvent)
+	logger              *slog.Logger
 
 	sync.Mutex
 }
@@ -26,19 +29,37 @@ type Offerer struct {
 func NewOfferer() *Offerer {
 	return &Offerer{
 		channel: make(chan *webrtc.DataChannel, 1),
+		logger:  slog.Default(),
 	}
 }
 
 func (o *Offerer) Offer(offerConfig *OfferConfig) (*Offer, error) {
-	const trickleAfter = 100 * time.Millisecond
-	end := time.Now().Add(trickleAfter)
+	if err := offerConfig.TrickleMode.validate(); err != nil {
+		return nil, err
+	}
+	if err := offerConfig.CandidateDelivery.validate(); err != nil {
+		return nil, err
+	}
+	batcher := newCandidateBatcher(offerConfig.TrickleMode, offerConfig.TrickleCutoff)
+
+	var pionLogger *slog.Logger
+	if offerConfig.Logger != nil {
+		o.logger = withRequestID(offerConfig.Logger, offerConfig.RequestID)
+		if offerConfig.SessionID != 0 {
+			o.logger = o.logger.With(logKeySessionID, offerConfig.SessionID)
+		}
+		pionLogger = o.logger
+	}
 
-	peerConnection, err := NewFilteredPeerConnection(offerConfig.ICEServers)
+	peerConnection, err := newPeerConnection(offerConfig.ICEServers, offerConfig.ICEPolicy, offerConfig.Certificate,
+		pionLogger, offerConfig.SettingEngine)
 	if err != nil {
 		return nil, err
 	}
 
 	o.connection = peerConnection
+	o.candidateFilter = offerConfig.RemoteCandidateFilter
+	o.onEvent = offerConfig.OnEvent
 
 	options := &webrtc.DataChannelInit{
 		Ordered:  &offerConfig.Ordered,
@@ -53,47 +74,45 @@ func (o *Offerer) Offer(offerConfig *OfferConfig) (*Offer, error) {
 	// This is the first data channel created on the connection, so it is the WAMP
 	// channel by convention; no handshake is needed to identify it as such.
 	dc.OnOpen(func() {
+		emitEvent(o.onEvent, ConnectionEvent{Type: EventDataChannelOpened, Label: dc.Label()})
 		o.channel <- dc
 	})
 
 	// Set the handler for Peer connection state
 	// This will notify you when the peer has connected/disconnected
 	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
-		log.Debugf("Peer Connection State has changed: %s\n", s.String())
+		o.logger.Debug("peer connection state changed", "state", s)
 	})
 
-	done := make(chan struct{}, 1)
-	var candMu sync.Mutex
-	var trickle bool
-	var initialCandidates []webrtc.ICECandidateInit
+	peerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		emitEvent(o.onEvent, ConnectionEvent{Type: EventICEStateChanged, ICEState: state})
+	})
+	watchDTLS(peerConnection, o.onEvent)
 
 	peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
 		if c == nil {
+			emitEvent(o.onEvent, ConnectionEvent{Type: EventCandidateGathered})
+			if !batcher.complete() {
+				o.handleICECandidate(endOfCandidates())
+			}
 			return
 		}
 
-		candMu.Lock()
-		if !trickle && !time.Now().After(end) {
-			initialCandidates = append(initialCandidates, c.ToJSON())
-			// First non-host candidate signals end of the fast host phase;
-			// everything after goes through the trickle path.
-			if c.Typ != webrtc.ICECandidateTypeHost {
-				trickle = true
-				candMu.Unlock()
-				select {
-				case done <- struct{}{}:
-				default:
-				}
-				return
-			}
-			candMu.Unlock()
+		if !offerConfig.ICEPolicy.allows(c) {
+			return
+		}
+		emitEvent(o.onEvent, ConnectionEvent{Type: EventCandidateGathered, Candidate: c.ToJSON().Candidate})
+		if batcher.add(c) {
 			return
 		}
-		candMu.Unlock()
 
 		o.handleICECandidate(c.ToJSON())
 	})
 
+	if offerConfig.OnPeerConnection != nil {
+		offerConfig.OnPeerConnection(peerConnection)
+	}
+
 	offer, err := peerConnection.CreateOffer(nil)
 	if err != nil {
 		return nil, err
@@ -105,18 +124,13 @@ func (o *Offerer) Offer(offerConfig *OfferConfig) (*Offer, error) {
 		return nil, err
 	}
 
-	select {
-	case <-done:
-	case <-time.After(time.Until(end)):
-	}
-
-	candMu.Lock()
-	resultCandidates := initialCandidates
-	candMu.Unlock()
-
 	return &Offer{
 		Description: offer,
-		Candidates:  resultCandidates,
+		Candidates:  batcher.wait(),
+		Trickle:     batcher.mode,
+		Delivery:    offerConfig.CandidateDelivery,
+		RequestID:   offerConfig.RequestID,
+		SessionID:   offerConfig.SessionID,
 	}, nil
 }
 
@@ -142,7 +156,11 @@ func (o *Offerer) HandleAnswer(answer Answer) error {
 	}
 
 	for _, candidate := range answer.Candidates {
-		if err := o.connection.AddICECandidate(candidate); err != nil {
+		if err := o.AddICECandidate(candidate); err != nil {
+			if errors.Is(err, ErrCandidateRejected) {
+				o.logger.Debug("dropping answer ICE candidate", "error", err)
+				continue
+			}
 			return err
 		}
 	}
@@ -150,8 +168,19 @@ func (o *Offerer) HandleAnswer(answer Answer) error {
 	return nil
 }
 
+// AddICECandidate validates a remote candidate against the answer and the
+// configured CandidateFilter, then adds it. An empty candidate marks the end
+// of the answerer's candidates.
 func (o *Offerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
-	return o.connection.AddICECandidate(candidate)
+	if err := validateRemoteCandidate(o.connection.RemoteDescription(), o.candidateFilter, candidate); err != nil {
+		return err
+	}
+
+	if err := o.connection.AddICECandidate(candidate); err != nil {
+		return err
+	}
+	emitEvent(o.onEvent, ConnectionEvent{Type: EventCandidateReceived, Candidate: candidate.Candidate})
+	return nil
 }
 
 func (o *Offerer) WaitReady() chan *webrtc.DataChannel {
@@ -182,7 +211,7 @@ func (o *Offerer) handleICECandidate(candidate webrtc.ICECandidateInit) {
 func (o *Offerer) publishCandidate(topic string, requestID string, candidate webrtc.ICECandidateInit) {
 	candidateData, err := json.Marshal(candidate)
 	if err != nil {
-		log.Debugf("failed to marshal candidate: %v", err)
+		o.logger.Debug("failed to marshal candidate", "error", err)
 		return
 	}
 
@@ -194,6 +223,8 @@ func (o *Offerer) publishCandidate(topic string, requestID string, candidate web
 	}
 
 	if err := publish(topic, requestID, string(candidateData)); err != nil {
-		log.Debugf("failed to publish ice candidate: %v", err)
+		o.logger.Debug("failed to publish ice candidate", "error", err)
+		return
 	}
+	emitEvent(o.onEvent, ConnectionEvent{Type: EventCandidateSent, Candidate: candidate.Candidate})
 }
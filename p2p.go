@@ -0,0 +1,72 @@
+package xconnwebrtc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xconnio/xconn-go"
+)
+
+// PeerListener lets two ordinary WAMP clients talk directly over WebRTC, with
+// the signaling router only brokering the offer, answer and candidates. The
+// listening client hosts realm on a LocalRouter and joins it itself
+// (PeerListener extends that local *xconn.Session). Remote peers dial it with
+// ConnectWAMP using the listener's procedure and topics, after which RPC and
+// events flow between the two peers without a hop through the signaling
+// router.
+type PeerListener struct {
+	*xconn.Session
+
+	local    *LocalRouter
+	provider *WebRTCProvider
+}
+
+// ListenPeer runs WebRTCProvider.Setup with config in local router mode (see
+// ProviderConfig.LocalRealm) hosting realm, so remote peers can join realm
+// over WebRTC. config.Router must be nil since the listener provides its own,
+// and config.Authenticator must be set; NewOpenAuthenticator admits every
+// remote peer anonymously with full access.
+func ListenPeer(config *ProviderConfig, realm string) (*PeerListener, error) {
+	if config == nil {
+		return nil, fmt.Errorf("provider config is nil")
+	}
+	if config.Router != nil {
+		return nil, fmt.Errorf("router must be nil: the peer listener embeds its own")
+	}
+	if realm == "" {
+		return nil, fmt.Errorf("realm must not be empty")
+	}
+
+	cfg := *config
+	cfg.LocalRealm = realm
+
+	provider := NewWebRTCHandler()
+	if err := provider.Setup(&cfg); err != nil {
+		return nil, err
+	}
+
+	local := provider.LocalRouter()
+	return &PeerListener{
+		Session:  local.Session(),
+		local:    local,
+		provider: provider,
+	}, nil
+}
+
+// Router returns the embedded router hosting the listener's realm.
+func (p *PeerListener) Router() *xconn.Router {
+	return p.local.Router()
+}
+
+// Provider returns the WebRTCProvider answering remote peers' offers, e.g. to
+// receive their raw data channels via OnDataChannel.
+func (p *PeerListener) Provider() *WebRTCProvider {
+	return p.provider
+}
+
+// Close shuts the provider down, so remote peers can't dial the listener
+// anymore and their PeerConnections close, then leaves the local session and
+// closes the embedded router, which ends every remote peer's session on it.
+func (p *PeerListener) Close() error {
+	return errors.Join(p.provider.Close(), p.local.Close())
+}
@@ -0,0 +1,90 @@
+package xconnwebrtc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+const (
+	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
+	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
+	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+)
+
+// loopbackOnly makes a PeerConnection gather loopback host candidates only.
+func loopbackOnly(settings *webrtc.SettingEngine) {
+	settings.SetIncludeLoopbackCandidate(true)
+	settings.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+}
+
+// listenLoopback runs a peer listener with config hosting realm1, signaling
+// over an in-process router, and returns it along with a client config to
+// connect to it.
+func listenLoopback(t *testing.T, config *xconnwebrtc.ProviderConfig) (*xconnwebrtc.PeerListener,
+	*xconnwebrtc.ClientConfig) {
+	signaling, err := xconnwebrtc.NewLocalRouter("signaling")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = signaling.Close() })
+
+	config.Session = signaling.Session()
+	config.ProcedureHandleOffer = procedureWebRTCOffer
+	config.TopicHandleRemoteCandidates = topicAnswererOnCandidate
+	config.TopicPublishLocalCandidate = topicOffererOnCandidate
+	config.SettingEngine = loopbackOnly
+	if config.Authenticator == nil {
+		config.Authenticator = xconnwebrtc.NewOpenAuthenticator()
+	}
+	listener, err := xconnwebrtc.ListenPeer(config, "realm1")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	session, err := signaling.Join()
+	require.NoError(t, err)
+
+	return listener, &xconnwebrtc.ClientConfig{
+		Realm:                    "realm1",
+		ProcedureWebRTCOffer:     procedureWebRTCOffer,
+		TopicAnswererOnCandidate: topicAnswererOnCandidate,
+		TopicOffererOnCandidate:  topicOffererOnCandidate,
+		Session:                  session,
+		SettingEngine:            loopbackOnly,
+		ConnectTimeout:           5 * time.Second,
+	}
+}
+
+func TestPeerListenerClose(t *testing.T) {
+	listener, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+	registerResp := listener.Register("com.example.echo",
+		func(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+			return xconn.NewInvocationResult(invocation.Args()...)
+		}).Do()
+	require.NoError(t, registerResp.Err)
+
+	session, err := xconnwebrtc.ConnectWAMP(config)
+	require.NoError(t, err)
+	callResp := session.Call("com.example.echo").Args("hello").Do()
+	require.NoError(t, callResp.Err)
+	echoed, err := callResp.ArgString(0)
+	require.NoError(t, err)
+	require.Equal(t, "hello", echoed)
+
+	require.NoError(t, listener.Close())
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote session didn't end")
+	}
+
+	// The offer procedure is gone with the listener.
+	callResp = config.Session.Call(procedureWebRTCOffer).Args("{}").Do()
+	require.Error(t, callResp.Err)
+}
@@ -2,8 +2,11 @@ package xconnwebrtc
 
 import (
 	"io"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 
@@ -25,14 +28,37 @@ type WebRTCPeer struct {
 
 	messageChan chan []byte
 	assembler   *WebRTCMessageAssembler
+	// cipher, if set, seals every message before it's chunked and opens it
+	// once reassembled; see EncryptionConfig.
+	cipher *e2eCipher
+	// sealMu keeps sealed messages on the wire in nonce order.
+	sealMu sync.Mutex
 
 	sendReady chan struct{}
 
 	done      chan struct{}
 	closeOnce sync.Once
+
+	// pongs receives the nonce of every keepalive pong; rtt is the latest
+	// measured round-trip time, in nanoseconds.
+	pongs chan uint64
+	rtt   atomic.Int64
+	// stalledSince is when the message handler started waiting for Read to
+	// take a message (zero while it isn't), stalled the total time it waited
+	// before, both in nanoseconds; see backpressure.
+	stalledSince atomic.Int64
+	stalled      atomic.Int64
+
+	logger *slog.Logger
 }
 
 func NewWebRTCPeer(channel *webrtc.DataChannel) xconn.Peer {
+	return newWebRTCPeer(channel, nil, slog.Default())
+}
+
+// newWebRTCPeer wraps channel; logger gets the channel's label as an
+// attribute.
+func newWebRTCPeer(channel *webrtc.DataChannel, cipher *e2eCipher, logger *slog.Logger) *WebRTCPeer {
 	messageChan := make(chan []byte, 1)
 
 	assembler := NewWebRTCMessageAssembler(MtuSize)
@@ -41,8 +67,11 @@ func NewWebRTCPeer(channel *webrtc.DataChannel) xconn.Peer {
 		channel:     channel,
 		messageChan: messageChan,
 		assembler:   assembler,
+		cipher:      cipher,
 		sendReady:   make(chan struct{}, 1),
 		done:        make(chan struct{}),
+		pongs:       make(chan uint64, 1),
+		logger:      logger.With(logKeyLabel, channel.Label()),
 	}
 
 	channel.SetBufferedAmountLowThreshold(bufferedAmountLow)
@@ -54,20 +83,59 @@ func NewWebRTCPeer(channel *webrtc.DataChannel) xconn.Peer {
 	})
 
 	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if peer.handleKeepalive(msg.Data) {
+			return
+		}
+
 		toSend := assembler.Feed(msg.Data)
 		if toSend == nil {
 			return
 		}
-
-		select {
-		case peer.messageChan <- toSend:
-		case <-peer.done:
+		if cipher != nil {
+			plaintext, err := cipher.open(toSend)
+			if err != nil {
+				peer.logger.Debug("closing encrypted channel", "error", err)
+				_ = peer.Close()
+				return
+			}
+			toSend = plaintext
 		}
+
+		peer.deliver(toSend)
 	})
 
 	return peer
 }
 
+// deliver hands msg to Read, recording how long that stalls the channel's
+// message handler, and with it every message (and pong) behind msg.
+func (w *WebRTCPeer) deliver(msg []byte) {
+	select {
+	case w.messageChan <- msg:
+		return
+	default:
+	}
+
+	start := time.Now()
+	w.stalledSince.Store(start.UnixNano())
+	select {
+	case w.messageChan <- msg:
+	case <-w.done:
+	}
+	w.stalledSince.Store(0)
+	w.stalled.Add(int64(time.Since(start)))
+}
+
+// backpressure returns the total time the message handler has waited for
+// Read so far.
+func (w *WebRTCPeer) backpressure() time.Duration {
+	stalled := w.stalled.Load()
+	if since := w.stalledSince.Load(); since != 0 {
+		stalled += time.Now().UnixNano() - since
+	}
+	return time.Duration(stalled)
+}
+
 func (w *WebRTCPeer) Type() xconn.TransportType {
 	return xconn.TransportNone
 }
@@ -86,6 +154,13 @@ func (w *WebRTCPeer) Read() ([]byte, error) {
 }
 
 func (w *WebRTCPeer) Write(bytes []byte) error {
+	if w.cipher != nil {
+		w.sealMu.Lock()
+		defer w.sealMu.Unlock()
+
+		bytes = w.cipher.seal(bytes)
+	}
+
 	for chunk := range w.assembler.ChunkMessage(bytes) {
 		for w.channel.BufferedAmount()+uint64(len(chunk)) > maxBufferedAmount {
 			select {
@@ -0,0 +1,76 @@
+package xconnwebrtc
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/xconnio/xconn-go"
+)
+
+// pipePeer is one end of an in-memory xconn.Peer pair, used to join a local
+// session to an embedded router without any network transport.
+type pipePeer struct {
+	in  <-chan []byte
+	out chan<- []byte
+
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// newPipePeers returns two connected peers: whatever one writes, the other
+// reads. Closing either end closes both.
+func newPipePeers() (xconn.Peer, xconn.Peer) {
+	aToB := make(chan []byte, 64)
+	bToA := make(chan []byte, 64)
+	done := make(chan struct{})
+	closeOnce := &sync.Once{}
+
+	a := &pipePeer{in: bToA, out: aToB, done: done, closeOnce: closeOnce}
+	b := &pipePeer{in: aToB, out: bToA, done: done, closeOnce: closeOnce}
+	return a, b
+}
+
+func (p *pipePeer) Type() xconn.TransportType {
+	return xconn.TransportNone
+}
+
+func (p *pipePeer) NetConn() net.Conn {
+	return nil
+}
+
+func (p *pipePeer) Read() ([]byte, error) {
+	select {
+	case msg := <-p.in:
+		return msg, nil
+	case <-p.done:
+		return nil, io.EOF
+	}
+}
+
+func (p *pipePeer) Write(bytes []byte) error {
+	select {
+	case p.out <- bytes:
+		return nil
+	case <-p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (p *pipePeer) TryWrite(bytes []byte) (bool, error) {
+	select {
+	case p.out <- bytes:
+		return true, nil
+	case <-p.done:
+		return false, io.ErrClosedPipe
+	default:
+		return false, nil
+	}
+}
+
+func (p *pipePeer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
@@ -3,27 +3,73 @@ package xconnwebrtc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wampproto-go"
 	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
 	"github.com/xconnio/xconn-go"
 )
 
+// candidateRoute is where the provider publishes one request's trickled
+// candidates, as asked for in its offer.
+type candidateRoute struct {
+	delivery  CandidateDelivery
+	sessionID uint64
+}
+
 type WebRTCProvider struct {
-	answerers     map[string]*Answerer
+	answerers map[string]*Answerer
+	routes    map[string]candidateRoute
+	callers   map[string]CallerDetails
+	// traces holds each request's SpanHandleOffer trace, for SpanAccept.
+	traces        map[string]trace
+	tickets       map[string]identityTicket
 	onNewAnswerer func(sessionID string, answerer *Answerer)
 	// onDataChannel receives every data channel that isn't a WAMP session.
 	onDataChannel func(sessionID string, channel *webrtc.DataChannel, firstMessage []byte)
+	// onSession receives every accepted WAMP session when there is no router.
+	onSession func(sessionID string, base xconn.BaseSession)
+	// onEvent receives the ConnectionEvents of every answered connection.
+	onEvent func(event ConnectionEvent)
+	// logger is ProviderConfig.Logger, nil for slog.Default().
+	logger *slog.Logger
+	tracer Tracer
 
 	iceServers []webrtc.ICEServer
+	icePolicy  ICEPolicy
+	settings   func(settings *webrtc.SettingEngine)
+	// trickleCutoff bounds TrickleModeCutoff answers.
+	trickleCutoff   time.Duration
+	candidateFilter CandidateFilter
+	encryption      *EncryptionConfig
+	maxSessions     int
+	keepalive       *KeepaliveConfig
+	minMessageSize  int
+	serializers     []transports.Serializer
+	// certificate is shared by every answered PeerConnection, if set.
+	certificate *webrtc.Certificate
+	// inheritIdentity issues identity tickets with every answer.
+	inheritIdentity   bool
+	identityTicketTTL time.Duration
+
+	localRouter *LocalRouter
+	// session is the signaling session of the latest Setup; answerers
+	// publish their candidates over it.
+	session *xconn.Session
+	// unregister undoes the registrations and subscription of the latest
+	// Setup, for Close.
+	unregister []func() error
 
 	sync.Mutex
 }
@@ -31,6 +77,10 @@ type WebRTCProvider struct {
 func NewWebRTCHandler() *WebRTCProvider {
 	return &WebRTCProvider{
 		answerers: make(map[string]*Answerer),
+		routes:    make(map[string]candidateRoute),
+		callers:   make(map[string]CallerDetails),
+		traces:    make(map[string]trace),
+		tickets:   make(map[string]identityTicket),
 	}
 }
 
@@ -41,6 +91,15 @@ func (r *WebRTCProvider) UpdateICEServers(servers []ICEServer) {
 	r.iceServers = cloneICEServers(servers)
 }
 
+// LocalRouter returns the embedded router Setup created for
+// ProviderConfig.LocalRealm, or nil if the provider isn't in local router mode.
+func (r *WebRTCProvider) LocalRouter() *LocalRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.localRouter
+}
+
 func (r *WebRTCProvider) OnAnswerer(callback func(sessionID string, answerer *Answerer)) {
 	r.Lock()
 	defer r.Unlock()
@@ -58,6 +117,49 @@ func (r *WebRTCProvider) OnDataChannel(callback func(sessionID string,
 	r.onDataChannel = callback
 }
 
+// OnSession registers a callback that receives every WAMP session accepted
+// (HELLO read and authenticated, WELCOME sent) over a data channel when
+// ProviderConfig has neither Router nor LocalRealm. The application then owns
+// base and serves it with its own logic, e.g. proxying or custom routing;
+// wrap it with xconn.NewSession to use it as a client session instead. base is
+// closed when its data channel closes. Without a callback such sessions are
+// closed right away.
+func (r *WebRTCProvider) OnSession(callback func(sessionID string, base xconn.BaseSession)) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.onSession = callback
+}
+
+// OnEvent registers a callback that receives the ConnectionEvents of every
+// answered connection, from EventOfferReceived to EventConnectionClosed,
+// stamped with the connection's request ID. It is called synchronously and
+// must not block.
+func (r *WebRTCProvider) OnEvent(callback func(event ConnectionEvent)) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.onEvent = callback
+}
+
+// requestLogger returns the logger for connection requestID.
+func (r *WebRTCProvider) requestLogger(requestID string) *slog.Logger {
+	r.Lock()
+	defer r.Unlock()
+
+	return withRequestID(loggerOrDefault(r.logger), requestID)
+}
+
+// emitEvent delivers event of connection requestID to the OnEvent callback.
+func (r *WebRTCProvider) emitEvent(requestID string, event ConnectionEvent) {
+	r.Lock()
+	callback := r.onEvent
+	r.Unlock()
+
+	event.RequestID = requestID
+	emitEvent(callback, event)
+}
+
 func (r *WebRTCProvider) ensureAnswerer(sessionID string) *Answerer {
 	r.Lock()
 	defer r.Unlock()
@@ -82,11 +184,15 @@ func (r *WebRTCProvider) removeAnswerer(sessionID string, answerer *Answerer) {
 		return
 	}
 	delete(r.answerers, sessionID)
+	delete(r.routes, sessionID)
+	delete(r.callers, sessionID)
+	delete(r.traces, sessionID)
+	delete(r.tickets, sessionID)
 	r.Unlock()
 
 	if answerer.connection != nil {
 		if err := answerer.connection.Close(); err != nil {
-			log.Debugf("failed to close peer connection for %s: %v", sessionID, err)
+			r.requestLogger(sessionID).Debug("failed to close peer connection", "error", err)
 		}
 	}
 }
@@ -98,7 +204,11 @@ func (r *WebRTCProvider) addIceCandidate(requestID string, candidate webrtc.ICEC
 
 func (r *WebRTCProvider) handleOffer(requestID string, offer Offer, answerConfig *AnswerConfig) (*Answer, error) {
 	answerer := r.ensureAnswerer(requestID)
-	answer, err := answerer.Answer(answerConfig, offer, 100*time.Millisecond)
+	r.Lock()
+	trickleCutoff := r.trickleCutoff
+	r.Unlock()
+
+	answer, err := answerer.Answer(answerConfig, offer, trickleCutoff)
 	if err != nil {
 		r.removeAnswerer(requestID, answerer)
 		return nil, err
@@ -109,8 +219,9 @@ func (r *WebRTCProvider) handleOffer(requestID string, offer Offer, answerConfig
 			switch state {
 			case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
 				r.removeAnswerer(requestID, answerer)
+				r.emitEvent(requestID, ConnectionEvent{Type: EventConnectionClosed, PeerState: state})
 			case webrtc.PeerConnectionStateDisconnected:
-				log.Debugf("peer connection disconnected for %s; keeping answerer alive for recovery", requestID)
+				r.requestLogger(requestID).Debug("peer connection disconnected; keeping answerer alive for recovery")
 			default:
 			}
 		})
@@ -123,30 +234,104 @@ func (r *WebRTCProvider) Setup(config *ProviderConfig) error {
 	if err := config.validate(); err != nil {
 		return fmt.Errorf("invalid provider config: %w", err)
 	}
-	r.iceServers = cloneICEServers(config.ICEServers)
-	registerResp := config.Session.Register(config.ProcedureHandleOffer, r.offerFunc).Do()
+	// Work on a copy: local router mode fills in Router, which must not leak
+	// into the caller's config.
+	cfg := *config
+	config = &cfg
+
+	certificate, err := r.configure(config)
+	if err != nil {
+		return err
+	}
+
+	var unregister []func() error
+	if config.ProcedureFingerprint != "" {
+		fingerprints, err := certificateFingerprints(certificate)
+		if err != nil {
+			return err
+		}
+
+		fingerprintResp := config.Session.Register(config.ProcedureFingerprint,
+			func(_ context.Context, _ *xconn.Invocation) *xconn.InvocationResult {
+				return xconn.NewInvocationResult(fingerprints)
+			}).Do()
+		if fingerprintResp.Err != nil {
+			return fmt.Errorf("failed to register webrtc fingerprint: %w", fingerprintResp.Err)
+		}
+		unregister = append(unregister, fingerprintResp.Unregister)
+	}
+
+	register := config.Session.Register(config.ProcedureHandleOffer, r.offerFunc)
+	if config.discloseCaller() {
+		register = register.Option("disclose_caller", true)
+	}
+	registerResp := register.Do()
 	if registerResp.Err != nil {
 		return fmt.Errorf("failed to register webrtc offer: %w", registerResp.Err)
 	}
+	unregister = append(unregister, registerResp.Unregister)
 
 	subscribeResp := config.Session.Subscribe(config.TopicHandleRemoteCandidates, r.onRemoteCandidate).Do()
 	if subscribeResp.Err != nil {
 		return fmt.Errorf("failed to subscribe to webrtc candidates events: %w", subscribeResp.Err)
 	}
+	unregister = append(unregister, subscribeResp.Unsubscribe)
+
+	r.Lock()
+	r.session = config.Session
+	r.unregister = unregister
+	r.Unlock()
+
+	if config.Upstream == nil && config.Router == nil && config.LocalRealm != "" {
+		// A repeated Setup, e.g. after reconnecting the signaling session,
+		// keeps the embedded router and the sessions on it.
+		local := r.LocalRouter()
+		if local == nil {
+			var err error
+			local, err = NewLocalRouter(config.LocalRealm)
+			if err != nil {
+				return err
+			}
+
+			r.Lock()
+			r.localRouter = local
+			r.Unlock()
+		}
+		config.Router = local.Router()
+	}
 
 	r.OnAnswerer(func(sessionID string, answerer *Answerer) {
-		answerer.OnIceCandidate(func(candidate *webrtc.ICECandidate) {
-			answerData, err := json.Marshal(candidate.ToJSON())
+		publishCandidate := func(candidate webrtc.ICECandidateInit) {
+			answerData, err := json.Marshal(candidate)
 			if err != nil {
-				log.Debugf("failed to marshal answer: %v", err)
+				r.requestLogger(sessionID).Debug("failed to marshal candidate", "error", err)
 				return
 			}
 
+			r.Lock()
+			route := r.routes[sessionID]
+			session := r.session
+			r.Unlock()
+
 			args := []any{sessionID, string(answerData)}
-			publishResp := config.Session.Publish(config.TopicPublishLocalCandidate).Args(args...).Do()
+			topic := candidateTopic(config.TopicPublishLocalCandidate, route.delivery, sessionID)
+			publish := session.Publish(topic).Args(args...)
+			if route.delivery == CandidateDeliveryEligible {
+				publish = publish.Option("eligible", []uint64{route.sessionID})
+			}
+			publishResp := publish.Do()
 			if publishResp.Err != nil {
-				log.Debugf("failed to publish answer: %v", publishResp.Err)
+				r.requestLogger(sessionID).Debug("failed to publish candidate", "error", publishResp.Err)
+				return
 			}
+			r.emitEvent(sessionID, ConnectionEvent{Type: EventCandidateSent, Candidate: candidate.Candidate})
+		}
+
+		answerer.OnIceCandidate(func(candidate *webrtc.ICECandidate) {
+			publishCandidate(candidate.ToJSON())
+		})
+		answerer.OnEndOfCandidates(func() {
+			publishCandidate(endOfCandidates())
 		})
 
 		answerer.OnDataChannel(func(channel *webrtc.DataChannel, firstMessage []byte) {
@@ -162,16 +347,30 @@ func (r *WebRTCProvider) Setup(config *ProviderConfig) error {
 		answerer.OnWAMPDataChannel(func(channel *webrtc.DataChannel, serializer serializers.Serializer) {
 			sessionEstablished.Store(true)
 
-			// NewWebRTCPeer must run synchronously here, before this callback
+			// answerer.NewWebRTCPeer must run synchronously here, before this callback
 			// returns: it registers channel.OnMessage, and pion won't start
 			// delivering messages on the channel until this callback returns
 			// (see OnDataChannel's doc comment). Deferring it into the
 			// goroutine below would race the client's HELLO against handler
 			// registration and could silently drop it.
-			rtcPeer := NewWebRTCPeer(channel)
+			rtcPeer := answerer.NewWebRTCPeer(channel)
+			if config.Upstream != nil {
+				channel.OnClose(func() {
+					_ = rtcPeer.Close()
+				})
+				go func() {
+					if err := proxyWAMPClient(rtcPeer, serializer, config.Upstream); err != nil {
+						r.requestLogger(sessionID).Debug("failed to proxy WAMP data channel",
+							logKeyLabel, channel.Label(), "error", err)
+					}
+				}()
+				return
+			}
+
 			go func() {
 				if err := r.handleWAMPClient(sessionID, channel, rtcPeer, serializer, config); err != nil {
-					log.Debugf("failed to handle WAMP data channel for session %s: %v", sessionID, err)
+					r.requestLogger(sessionID).Debug("failed to handle WAMP data channel",
+						logKeyLabel, channel.Label(), "error", err)
 				}
 			}()
 		})
@@ -179,7 +378,7 @@ func (r *WebRTCProvider) Setup(config *ProviderConfig) error {
 		go func() {
 			<-time.After(20 * time.Second)
 			if !sessionEstablished.Load() {
-				log.Debugln("webrtc connection didn't establish after 20 seconds")
+				r.requestLogger(sessionID).Debug("webrtc connection didn't establish after 20 seconds")
 				r.removeAnswerer(sessionID, answerer)
 			}
 		}()
@@ -188,52 +387,184 @@ func (r *WebRTCProvider) Setup(config *ProviderConfig) error {
 	return nil
 }
 
+// Close shuts the provider down: it unregisters the offer procedure and the
+// candidate subscription of the latest Setup, so no new offers arrive, and
+// closes every answered PeerConnection, ending the sessions on them. The
+// signaling session and an embedded LocalRouter stay open.
+func (r *WebRTCProvider) Close() error {
+	r.Lock()
+	unregister := r.unregister
+	r.unregister = nil
+	answerers := maps.Clone(r.answerers)
+	r.Unlock()
+
+	var errs []error
+	for _, undo := range unregister {
+		if err := undo(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for sessionID, answerer := range answerers {
+		r.removeAnswerer(sessionID, answerer)
+	}
+	return errors.Join(errs...)
+}
+
+// configure applies config's answer options, returning the certificate to
+// answer with. Serve calls Setup again on every reconnect, while offers that
+// arrived over the previous signaling session may still be answered, so the
+// options only change under the lock.
+func (r *WebRTCProvider) configure(config *ProviderConfig) (*webrtc.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	certificate := config.Certificate
+	if certificate == nil && config.ProcedureFingerprint != "" {
+		// Keep publishing the same fingerprint across repeated Setups.
+		certificate = r.certificate
+	}
+	if certificate == nil && config.ProcedureFingerprint != "" {
+		generated, err := generateCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate DTLS certificate: %w", err)
+		}
+		certificate = generated
+	}
+
+	r.iceServers = cloneICEServers(config.ICEServers)
+	r.icePolicy = config.ICEPolicy
+	r.settings = config.SettingEngine
+	r.trickleCutoff = config.TrickleCutoff
+	r.candidateFilter = config.RemoteCandidateFilter
+	r.inheritIdentity = config.InheritIdentity
+	r.identityTicketTTL = config.IdentityTicketTTL
+	r.encryption = config.Encryption
+	r.maxSessions = config.MaxSessions
+	r.keepalive = config.Keepalive
+	r.minMessageSize = config.MinMessageSize
+	r.serializers = slices.Clone(config.Serializers)
+	r.logger = config.Logger
+	r.tracer = tracerOrNoop(config.Tracer)
+	r.certificate = certificate
+	return certificate, nil
+}
+
+// answerConfig returns the AnswerConfig for connection requestID from the
+// current options.
+func (r *WebRTCProvider) answerConfig(requestID string) *AnswerConfig {
+	r.Lock()
+	defer r.Unlock()
+
+	config := &AnswerConfig{
+		ICEServers:            cloneICEServers(r.iceServers),
+		ICEPolicy:             r.icePolicy,
+		SettingEngine:         r.settings,
+		RemoteCandidateFilter: r.candidateFilter,
+		Certificate:           r.certificate,
+		Encryption:            r.encryption,
+		MaxSessions:           r.maxSessions,
+		MinMessageSize:        r.minMessageSize,
+		Serializers:           r.serializers,
+		Keepalive:             r.keepalive,
+		OnEvent: func(event ConnectionEvent) {
+			r.emitEvent(requestID, event)
+		},
+	}
+	if r.logger != nil {
+		config.Logger = withRequestID(r.logger, requestID)
+	}
+	return config
+}
+
 // handleWAMPClient runs one WAMP session on channel: RawSocket-equivalent
-// HELLO/WELCOME handshake, router attach, message loop. A connection can host
+// HELLO/WELCOME handshake on the router and realm picked by the
+// RealmResolver, if any, then either router attach and message loop, or,
+// without a router, hand-off to the OnSession callback. A connection can host
 // several concurrent sessions (see OnWAMPDataChannel), so a failure here must
 // only tear down this session, not the whole PeerConnection/Answerer.
 func (r *WebRTCProvider) handleWAMPClient(sessionID string, channel *webrtc.DataChannel,
 	rtcPeer xconn.Peer, serializer serializers.Serializer, config *ProviderConfig) error {
 
-	hello, err := xconn.ReadHello(rtcPeer, serializer)
-	if err != nil {
-		return err
+	r.Lock()
+	t, ok := r.traces[sessionID]
+	if !ok {
+		t = newTrace(context.Background(), r.tracer)
 	}
+	r.Unlock()
 
-	base, err := xconn.Accept(rtcPeer, hello, serializer, config.Authenticator)
+	_, span := t.start(SpanAccept)
+	span.SetAttribute(logKeyLabel, channel.Label())
+	base, router, err := r.acceptWAMPClient(sessionID, rtcPeer, serializer, config)
+	if err == nil {
+		span.SetAttribute(logKeySessionID, base.ID())
+	}
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
+	r.emitEvent(sessionID, ConnectionEvent{Type: EventJoined, Label: channel.Label(), SessionID: base.ID()})
+
+	channel.OnClose(func() {
+		_ = base.Close()
+		r.emitEvent(sessionID, ConnectionEvent{Type: EventSessionClosed, Label: channel.Label(), SessionID: base.ID()})
+	})
+
+	if router == nil {
+		r.Lock()
+		cb := r.onSession
+		r.Unlock()
+		if cb == nil {
+			_ = base.Close()
+			return fmt.Errorf("no router or session handler for session %d", base.ID())
+		}
 
-	if config.Router == nil {
+		cb(sessionID, base)
 		return nil
 	}
 
-	if err = config.Router.AttachClient(base); err != nil {
-		return fmt.Errorf("failed to attach client %w", err)
+	return serveRouterClient(router, base)
+}
+
+// acceptWAMPClient reads and authenticates the HELLO on rtcPeer, returning
+// the accepted session and the router it goes to, if any.
+func (r *WebRTCProvider) acceptWAMPClient(sessionID string, rtcPeer xconn.Peer, serializer serializers.Serializer,
+	config *ProviderConfig) (xconn.BaseSession, *xconn.Router, error) {
+
+	hello, err := xconn.ReadHello(rtcPeer, serializer)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	channel.OnClose(func() {
-		_ = base.Close()
-	})
+	target := realmTarget{router: config.Router, authenticator: config.Authenticator, hello: hello}
+	if config.RealmResolver != nil {
+		r.Lock()
+		caller := r.callers[sessionID]
+		r.Unlock()
 
-	for {
-		msg, err := base.ReadMessage()
+		target, err = resolveRealm(config.RealmResolver, &RealmRequest{
+			RequestID:   sessionID,
+			Realm:       hello.Realm(),
+			AuthID:      hello.AuthID(),
+			AuthMethods: hello.AuthMethods(),
+			Caller:      caller,
+		}, target)
 		if err != nil {
-			_ = config.Router.DetachClient(base)
-			break
+			abortPeer(rtcPeer, serializer, wampproto.ErrNoSuchRealm, err)
+			return nil, nil, fmt.Errorf("realm %q rejected: %w", hello.Realm(), err)
 		}
+	}
 
-		if err = config.Router.ReceiveMessage(base, msg); err != nil {
-			log.Debugf("failed to receive message for session %s: %v", sessionID, err)
-			return nil
-		}
+	authenticator := r.identityAuthenticator(sessionID, target.authenticator)
+
+	base, err := xconn.Accept(rtcPeer, target.hello, serializer, authenticator)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return err
+	return base, target.router, nil
 }
 
-func (r *WebRTCProvider) offerFunc(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+func (r *WebRTCProvider) offerFunc(ctx context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
 	if len(invocation.Args()) < 1 {
 		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, "must be called with offer as argument")
 	}
@@ -248,27 +579,143 @@ func (r *WebRTCProvider) offerFunc(_ context.Context, invocation *xconn.Invocati
 		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, fmt.Sprintf("invalid offer: %v", err))
 	}
 
+	// Continue the offerer's trace, if it sent one.
 	r.Lock()
-	cfg := &AnswerConfig{ICEServers: cloneICEServers(r.iceServers)}
+	tracer := tracerOrNoop(r.tracer)
 	r.Unlock()
-	requestID := uuid.New().String()
+	t, span := newTrace(tracer.Extract(ctx, offer.TraceContext), tracer).start(SpanHandleOffer)
+	fail := func(uri string, err error) *xconn.InvocationResult {
+		endSpan(span, err)
+		return xconn.NewInvocationError(uri, err)
+	}
 
+	requestID, err := r.routeOffer(offer, invocation.Details())
+	if err != nil {
+		return fail(wampproto.ErrInvalidArgument, err)
+	}
+	span.SetAttribute(logKeyRequestID, requestID)
+
+	r.emitEvent(requestID, ConnectionEvent{Type: EventOfferReceived})
+	caller := callerDetails(invocation.Details())
+
+	var ticket *identityTicket
+	if r.inheritsIdentity() {
+		issued, err := r.newIdentityTicket(caller)
+		if err != nil {
+			r.releaseRequestID(requestID)
+			return fail(wampproto.ErrNotAuthorized, err)
+		}
+		ticket = &issued
+	}
+
+	r.Lock()
+	r.callers[requestID] = caller
+	r.traces[requestID] = t
+	if ticket != nil {
+		r.tickets[requestID] = *ticket
+	}
+	r.Unlock()
+
+	cfg := r.answerConfig(requestID)
 	answer, err := r.handleOffer(requestID, offer, cfg)
 	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err)
+		return fail(wampproto.ErrInvalidArgument, err)
 	}
 
-	responseData, err := json.Marshal(OfferResponse{
+	response := OfferResponse{
 		RequestID: requestID,
 		Answer:    *answer,
-	})
+	}
+	if ticket != nil {
+		response.AuthID = ticket.authID
+		response.Ticket = ticket.ticket
+	}
+
+	responseData, err := json.Marshal(response)
 	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err)
+		return fail(wampproto.ErrInvalidArgument, err)
 	}
 
+	span.End()
+	r.emitEvent(requestID, ConnectionEvent{Type: EventAnswerSent})
 	return xconn.NewInvocationResult(string(responseData))
 }
 
+// routeOffer picks the request ID for offer and claims it along with where
+// its trickled candidates go. The offerer chooses the request ID for
+// CandidateDeliveryPerRequest, and the eligible session for
+// CandidateDeliveryEligible is the disclosed caller when the router discloses
+// it.
+func (r *WebRTCProvider) routeOffer(offer Offer, details map[string]any) (string, error) {
+	if err := offer.Delivery.validate(); err != nil {
+		return "", err
+	}
+
+	route := candidateRoute{delivery: offer.Delivery}
+
+	requestID := uuid.New().String()
+	if offer.RequestID != "" {
+		if _, err := uuid.Parse(offer.RequestID); err != nil {
+			return "", fmt.Errorf("invalid request ID %q: %w", offer.RequestID, err)
+		}
+		requestID = offer.RequestID
+	} else if offer.Delivery == CandidateDeliveryPerRequest {
+		return "", fmt.Errorf("per-request candidate delivery requires a request ID")
+	}
+
+	if offer.Delivery == CandidateDeliveryEligible {
+		caller, disclosed := callerSessionID(details)
+		switch {
+		case disclosed && offer.SessionID != 0 && offer.SessionID != caller:
+			return "", fmt.Errorf("session ID %d does not match caller %d", offer.SessionID, caller)
+		case disclosed:
+			route.sessionID = caller
+		case offer.SessionID != 0:
+			route.sessionID = offer.SessionID
+		default:
+			return "", fmt.Errorf("eligible candidate delivery requires a session ID")
+		}
+	}
+
+	// Checking and claiming in one step keeps two concurrent offers with the
+	// same request ID from sharing an Answerer. The claim lasts until the
+	// Answerer is removed.
+	r.Lock()
+	defer r.Unlock()
+
+	if _, claimed := r.routes[requestID]; claimed {
+		return "", fmt.Errorf("request ID %q is already in use", requestID)
+	}
+	r.routes[requestID] = route
+	return requestID, nil
+}
+
+// releaseRequestID gives up the claim on requestID of an offer that failed
+// before it was answered.
+func (r *WebRTCProvider) releaseRequestID(requestID string) {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.routes, requestID)
+}
+
+// callerSessionID extracts the caller's session ID from invocation details, if
+// the router disclosed it.
+func callerSessionID(details map[string]any) (uint64, bool) {
+	switch caller := details["caller"].(type) {
+	case uint64:
+		return caller, true
+	case int64:
+		return uint64(caller), caller > 0
+	case int:
+		return uint64(caller), caller > 0
+	case float64:
+		return uint64(caller), caller > 0
+	default:
+		return 0, false
+	}
+}
+
 func (r *WebRTCProvider) onRemoteCandidate(event *xconn.Event) {
 	if len(event.Args()) < 2 {
 		return
@@ -276,13 +723,13 @@ func (r *WebRTCProvider) onRemoteCandidate(event *xconn.Event) {
 
 	requestID, err := event.ArgString(0)
 	if err != nil {
-		log.Debugln("request ID must be a string")
+		r.requestLogger("").Debug("request ID must be a string")
 		return
 	}
 
 	candidateJSON, err := event.ArgString(1)
 	if err != nil {
-		log.Debugln("offer must be a string")
+		r.requestLogger(requestID).Debug("candidate must be a string")
 		return
 	}
 
@@ -292,7 +739,7 @@ func (r *WebRTCProvider) onRemoteCandidate(event *xconn.Event) {
 	}
 
 	if err := r.addIceCandidate(requestID, candidate); err != nil {
-		log.Debugf("failed to add ice candidate: %v", err)
+		r.requestLogger(requestID).Debug("failed to add ice candidate", "error", err)
 		return
 	}
 }
@@ -0,0 +1,97 @@
+package xconnwebrtc_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// TestProviderReconfigure reapplies the provider config, as Serve does on
+// every reconnect, while offers are being answered; run with -race.
+func TestProviderReconfigure(t *testing.T) {
+	provider := xconnwebrtc.NewWebRTCHandler()
+	newConfig := func(i int) *xconnwebrtc.ProviderConfig {
+		return &xconnwebrtc.ProviderConfig{
+			ICEServers:           []webrtc.ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+			TrickleCutoff:        time.Duration(i+1) * time.Millisecond,
+			MaxSessions:          i,
+			Keepalive:            &xconnwebrtc.KeepaliveConfig{Interval: time.Second, Timeout: time.Second},
+			ProcedureFingerprint: "com.example.fingerprint",
+		}
+	}
+	require.NoError(t, provider.Configure(newConfig(0)))
+	certificate := provider.AnswerConfig("").Certificate
+	require.NotNil(t, certificate)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			assert.NoError(t, provider.Configure(newConfig(i)))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			config := provider.AnswerConfig("request")
+			assert.Len(t, config.ICEServers, 1)
+			assert.Same(t, certificate, config.Certificate)
+		}
+	}()
+	wg.Wait()
+
+	require.Equal(t, 99, provider.AnswerConfig("").MaxSessions)
+}
+
+func TestListenPeerRequiresAuthenticator(t *testing.T) {
+	config := &xconnwebrtc.ProviderConfig{
+		Session:                     &xconn.Session{},
+		ProcedureHandleOffer:        "com.example.offer",
+		TopicHandleRemoteCandidates: "com.example.answerer.on_candidate",
+		TopicPublishLocalCandidate:  "com.example.offerer.on_candidate",
+	}
+
+	_, err := xconnwebrtc.ListenPeer(config, "com.example.realm")
+	require.ErrorContains(t, err, "NewOpenAuthenticator")
+	require.Nil(t, config.Router)
+	require.Empty(t, config.LocalRealm)
+}
+
+func TestRouteOfferClaimsRequestID(t *testing.T) {
+	provider := xconnwebrtc.NewWebRTCHandler()
+	offer := xconnwebrtc.Offer{
+		Delivery:  xconnwebrtc.CandidateDeliveryPerRequest,
+		RequestID: "6f1c7b0e-2f4e-4c1a-9d3b-8a7e5c4d2b1a",
+	}
+
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if requestID, err := provider.RouteOffer(offer); err == nil {
+				assert.Equal(t, offer.RequestID, requestID)
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), claimed.Load())
+
+	// Offers without a request ID get a fresh one each.
+	first, err := provider.RouteOffer(xconnwebrtc.Offer{})
+	require.NoError(t, err)
+	second, err := provider.RouteOffer(xconnwebrtc.Offer{})
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+}
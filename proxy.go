@@ -0,0 +1,289 @@
+package xconnwebrtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+)
+
+// upstreamDialTimeout bounds how long a proxied session waits for its
+// upstream connection.
+const upstreamDialTimeout = 20 * time.Second
+
+// UpstreamDialer opens one transport to an upstream router for one proxied
+// WAMP session, speaking serializer. See ProviderConfig.Upstream.
+type UpstreamDialer func(ctx context.Context, serializer serializers.Serializer) (xconn.Peer, error)
+
+// rawSocketSerializerID returns the id serializer is registered under; see
+// RegisterSerializer.
+func rawSocketSerializerID(serializer serializers.Serializer) (transports.Serializer, error) {
+	id, ok := registeredSerializerID(serializer)
+	if !ok {
+		return 0, fmt.Errorf("unsupported serializer %T", serializer)
+	}
+	return id, nil
+}
+
+// webSocketSubProtocol returns the WAMP WebSocket subprotocol for serializer.
+// Only the built-in serializer ids have one.
+func webSocketSubProtocol(serializer serializers.Serializer) (string, error) {
+	id, err := rawSocketSerializerID(serializer)
+	if err != nil {
+		return "", err
+	}
+
+	switch id {
+	case transports.SerializerJson:
+		return "wamp.2.json", nil
+	case transports.SerializerMsgpack:
+		return "wamp.2.msgpack", nil
+	case transports.SerializerCbor:
+		return "wamp.2.cbor", nil
+	default:
+		return "", fmt.Errorf("serializer %d has no WebSocket subprotocol", id)
+	}
+}
+
+// WebSocketUpstream dials the upstream router at url (e.g.
+// "ws://router:8080/ws") over WebSocket.
+func WebSocketUpstream(url string) UpstreamDialer {
+	return func(ctx context.Context, serializer serializers.Serializer) (xconn.Peer, error) {
+		subProtocol, err := webSocketSubProtocol(serializer)
+		if err != nil {
+			return nil, err
+		}
+
+		dialer := ws.Dialer{Protocols: []string{subProtocol}}
+		conn, _, handshake, err := dialer.Dial(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		if handshake.Protocol != subProtocol {
+			_ = conn.Close()
+			return nil, fmt.Errorf("upstream did not accept subprotocol %q", subProtocol)
+		}
+
+		opCode := ws.OpBinary
+		if subProtocol == "wamp.2.json" {
+			opCode = ws.OpText
+		}
+
+		return &webSocketUpstreamPeer{conn: conn, opCode: opCode}, nil
+	}
+}
+
+type webSocketUpstreamPeer struct {
+	conn   net.Conn
+	opCode ws.OpCode
+
+	writeMu sync.Mutex
+}
+
+func (p *webSocketUpstreamPeer) Type() xconn.TransportType {
+	return xconn.TransportWebSocket
+}
+
+func (p *webSocketUpstreamPeer) NetConn() net.Conn {
+	return p.conn
+}
+
+func (p *webSocketUpstreamPeer) Read() ([]byte, error) {
+	data, _, err := wsutil.ReadServerData(p.conn)
+	return data, err
+}
+
+func (p *webSocketUpstreamPeer) Write(bytes []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	return wsutil.WriteClientMessage(p.conn, p.opCode, bytes)
+}
+
+func (p *webSocketUpstreamPeer) TryWrite(bytes []byte) (bool, error) {
+	if err := p.Write(bytes); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *webSocketUpstreamPeer) Close() error {
+	return p.conn.Close()
+}
+
+// RawSocketUpstream dials the upstream router at address (e.g.
+// "router:8081") over RawSocket on network ("tcp" or "unix").
+func RawSocketUpstream(network, address string) UpstreamDialer {
+	return func(ctx context.Context, serializer serializers.Serializer) (xconn.Peer, error) {
+		serializerID, err := rawSocketSerializerID(serializer)
+		if err != nil {
+			return nil, err
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		hsBytes, err := buildHandshake(serializerID)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if _, err = conn.Write(hsBytes); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		resp := make([]byte, 4)
+		if _, err = io.ReadFull(conn, resp); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		hs, err := transports.ReceiveHandshake(resp)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if hs.Serializer() != serializerID {
+			_ = conn.Close()
+			return nil, fmt.Errorf("upstream rejected serializer %d", serializerID)
+		}
+
+		_ = conn.SetDeadline(time.Time{})
+		return &rawSocketUpstreamPeer{conn: conn, maxMessageSize: hs.MaxMessageSize()}, nil
+	}
+}
+
+type rawSocketUpstreamPeer struct {
+	conn           net.Conn
+	maxMessageSize int
+
+	writeMu sync.Mutex
+}
+
+func (p *rawSocketUpstreamPeer) Type() xconn.TransportType {
+	return xconn.TransportRawSocket
+}
+
+func (p *rawSocketUpstreamPeer) NetConn() net.Conn {
+	return p.conn
+}
+
+func (p *rawSocketUpstreamPeer) Read() ([]byte, error) {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(p.conn, header); err != nil {
+			return nil, err
+		}
+
+		msgHeader, err := transports.ReceiveMessageHeader(header)
+		if err != nil {
+			return nil, err
+		}
+
+		payload := make([]byte, msgHeader.Length())
+		if _, err = io.ReadFull(p.conn, payload); err != nil {
+			return nil, err
+		}
+
+		switch msgHeader.Kind() {
+		case transports.MessageWamp:
+			return payload, nil
+		case transports.MessagePing:
+			if err = p.writeFrame(transports.MessagePong, payload); err != nil {
+				return nil, err
+			}
+		default:
+		}
+	}
+}
+
+func (p *rawSocketUpstreamPeer) Write(bytes []byte) error {
+	if len(bytes) > p.maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds upstream maximum of %d", len(bytes), p.maxMessageSize)
+	}
+
+	return p.writeFrame(transports.MessageWamp, bytes)
+}
+
+func (p *rawSocketUpstreamPeer) writeFrame(kind transports.Message, payload []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	header := transports.SendMessageHeader(transports.NewMessageHeader(kind, len(payload)))
+	if _, err := p.conn.Write(header); err != nil {
+		return err
+	}
+
+	_, err := p.conn.Write(payload)
+	return err
+}
+
+func (p *rawSocketUpstreamPeer) TryWrite(bytes []byte) (bool, error) {
+	if err := p.Write(bytes); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *rawSocketUpstreamPeer) Close() error {
+	return p.conn.Close()
+}
+
+// proxyWAMPClient forwards one WAMP session message by message between
+// rtcPeer and a fresh upstream connection, starting with the client's HELLO.
+// Authentication happens end to end: the upstream router sees the client's
+// own HELLO and AUTHENTICATE, so its authenticator (or a ticket the client
+// presents) decides who the client is.
+func proxyWAMPClient(rtcPeer xconn.Peer, serializer serializers.Serializer, dial UpstreamDialer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamDialTimeout)
+	upstream, err := dial(ctx, serializer)
+	cancel()
+	if err != nil {
+		_ = rtcPeer.Close()
+		return fmt.Errorf("failed to dial upstream: %w", err)
+	}
+
+	errCh := make(chan error, 2)
+	pump := func(from, to xconn.Peer) {
+		for {
+			msg, err := from.Read()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if err = to.Write(msg); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}
+
+	go pump(rtcPeer, upstream)
+	go pump(upstream, rtcPeer)
+
+	err = <-errCh
+	_ = upstream.Close()
+	_ = rtcPeer.Close()
+
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
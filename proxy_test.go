@@ -0,0 +1,108 @@
+package xconnwebrtc_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// serveEchoRawSocket accepts one RawSocket connection on listener, answers
+// its handshake and echoes every WAMP message, reporting the serializer the
+// client asked for.
+func serveEchoRawSocket(listener net.Listener) <-chan transports.Serializer {
+	requested := make(chan transports.Serializer, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		request := make([]byte, 4)
+		if _, err = io.ReadFull(conn, request); err != nil {
+			return
+		}
+		hs, err := transports.ReceiveHandshake(request)
+		if err != nil {
+			return
+		}
+		requested <- hs.Serializer()
+
+		accepted := transports.NewHandshake(hs.Serializer(), transports.DefaultMaxMsgSize)
+		response, err := transports.SendHandshake(accepted)
+		if err != nil {
+			return
+		}
+		if _, err = conn.Write(response); err != nil {
+			return
+		}
+
+		header := make([]byte, 4)
+		for {
+			if _, err = io.ReadFull(conn, header); err != nil {
+				return
+			}
+			msgHeader, err := transports.ReceiveMessageHeader(header)
+			if err != nil {
+				return
+			}
+			payload := make([]byte, msgHeader.Length())
+			if _, err = io.ReadFull(conn, payload); err != nil {
+				return
+			}
+			if _, err = conn.Write(append(header, payload...)); err != nil {
+				return
+			}
+		}
+	}()
+	return requested
+}
+
+func TestProxyWAMPClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	requested := serveEchoRawSocket(listener)
+
+	client, rtcPeer := xconnwebrtc.NewPipePeers()
+	dial := xconnwebrtc.RawSocketUpstream("tcp", listener.Addr().String())
+
+	proxyErr := make(chan error, 1)
+	go func() {
+		proxyErr <- xconnwebrtc.ProxyWAMPClient(rtcPeer, &serializers.CBORSerializer{}, dial)
+	}()
+
+	require.NoError(t, client.Write([]byte("hello")))
+	echoed, err := client.Read()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(echoed))
+	require.Equal(t, transports.SerializerCbor, <-requested)
+
+	require.NoError(t, client.Close())
+	select {
+	case err = <-proxyErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy didn't stop after the client closed")
+	}
+}
+
+func TestProxyWAMPClientUnsupportedSerializer(t *testing.T) {
+	client, rtcPeer := xconnwebrtc.NewPipePeers()
+	defer client.Close()
+
+	dial := xconnwebrtc.WebSocketUpstream("ws://127.0.0.1:1/ws")
+	err := xconnwebrtc.ProxyWAMPClient(rtcPeer, &unregisteredSerializer{}, dial)
+	require.ErrorContains(t, err, "unsupported serializer")
+}
+
+type unregisteredSerializer struct {
+	serializers.JSONSerializer
+}
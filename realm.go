@@ -0,0 +1,107 @@
+package xconnwebrtc
+
+import (
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/wampproto-go/messages"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/xconn-go"
+)
+
+// CallerDetails identifies the signaling session that made an offer, as far
+// as the signaling router disclosed it; unknown fields are left zero.
+type CallerDetails struct {
+	SessionID uint64
+	AuthID    string
+	AuthRole  string
+}
+
+// callerDetails extracts the disclosed caller from invocation details.
+func callerDetails(details map[string]any) CallerDetails {
+	caller, _ := callerSessionID(details)
+	authID, _ := details["caller_authid"].(string)
+	authRole, _ := details["caller_authrole"].(string)
+
+	return CallerDetails{
+		SessionID: caller,
+		AuthID:    authID,
+		AuthRole:  authRole,
+	}
+}
+
+// RealmRequest describes a WAMP session asking to join, as seen by a
+// RealmResolver.
+type RealmRequest struct {
+	// RequestID identifies the offer whose PeerConnection carries the session.
+	RequestID   string
+	Realm       string
+	AuthID      string
+	AuthMethods []string
+	// Caller is the signaling session that made the offer.
+	Caller CallerDetails
+}
+
+// RealmRoute is where a RealmResolver sends a WAMP session.
+type RealmRoute struct {
+	// Router the session is attached to. If nil, the session goes to
+	// WebRTCProvider.OnSession instead.
+	Router *xconn.Router
+	// Realm the session joins on Router; empty keeps the requested realm.
+	Realm string
+	// Authenticator authenticates the session; nil falls back to
+	// ProviderConfig.Authenticator.
+	Authenticator auth.ServerAuthenticator
+}
+
+// RealmResolver decides which router and realm each WAMP session joins, so
+// one provider can serve many tenants with isolated routers. Returning an
+// error rejects the session with an ABORT (wamp.error.no_such_realm) carrying
+// the error's message; returning a nil route keeps ProviderConfig.Router and
+// Authenticator and the requested realm.
+type RealmResolver func(request *RealmRequest) (*RealmRoute, error)
+
+// realmTarget is where an accepted session goes: its router, the
+// authenticator admitting it and the HELLO it is accepted with.
+type realmTarget struct {
+	router        *xconn.Router
+	authenticator auth.ServerAuthenticator
+	hello         *messages.Hello
+}
+
+// resolveRealm asks resolver where request goes, starting from defaults.
+func resolveRealm(resolver RealmResolver, request *RealmRequest, defaults realmTarget) (realmTarget, error) {
+	route, err := resolver(request)
+	if err != nil {
+		return realmTarget{}, err
+	}
+	if route == nil {
+		return defaults, nil
+	}
+
+	target := realmTarget{
+		router:        route.Router,
+		authenticator: defaults.authenticator,
+		hello:         rewriteHelloRealm(defaults.hello, route.Realm),
+	}
+	if route.Authenticator != nil {
+		target.authenticator = route.Authenticator
+	}
+	return target, nil
+}
+
+// rewriteHelloRealm returns hello with its realm replaced by realm.
+func rewriteHelloRealm(hello *messages.Hello, realm string) *messages.Hello {
+	if realm == "" || realm == hello.Realm() {
+		return hello
+	}
+
+	return messages.NewHello(realm, hello.AuthID(), hello.AuthExtra(), hello.Roles(), hello.AuthMethods())
+}
+
+// abortPeer rejects a session that has sent HELLO but not been welcomed.
+func abortPeer(peer xconn.Peer, serializer serializers.Serializer, reason string, cause error) {
+	data, err := serializer.Serialize(messages.NewAbort(map[string]any{}, reason, []any{cause.Error()}, nil))
+	if err == nil {
+		_ = peer.Write(data)
+	}
+	_ = peer.Close()
+}
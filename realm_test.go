@@ -0,0 +1,48 @@
+package xconnwebrtc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func TestResolveRealm(t *testing.T) {
+	defaultRouter := &xconn.Router{}
+	defaultAuthenticator := xconnwebrtc.NewOpenAuthenticator()
+
+	t.Run("Reject", func(t *testing.T) {
+		errUnknown := errors.New("unknown tenant")
+		_, _, _, err := xconnwebrtc.ResolveRealm(func(*xconnwebrtc.RealmRequest) (*xconnwebrtc.RealmRoute, error) {
+			return nil, errUnknown
+		}, "com.example.tenant", defaultRouter, defaultAuthenticator)
+		require.ErrorIs(t, err, errUnknown)
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		tenantRouter := &xconn.Router{}
+		router, authenticator, realm, err := xconnwebrtc.ResolveRealm(
+			func(request *xconnwebrtc.RealmRequest) (*xconnwebrtc.RealmRoute, error) {
+				return &xconnwebrtc.RealmRoute{Router: tenantRouter, Realm: "tenant." + request.Realm}, nil
+			}, "com.example", defaultRouter, defaultAuthenticator)
+		require.NoError(t, err)
+		require.Same(t, tenantRouter, router)
+		require.Equal(t, defaultAuthenticator, authenticator)
+		require.Equal(t, "tenant.com.example", realm)
+	})
+
+	t.Run("NilRoute", func(t *testing.T) {
+		keepDefaults := func(*xconnwebrtc.RealmRequest) (*xconnwebrtc.RealmRoute, error) {
+			return nil, nil
+		}
+		router, authenticator, realm, err := xconnwebrtc.ResolveRealm(keepDefaults, "com.example",
+			defaultRouter, defaultAuthenticator)
+		require.NoError(t, err)
+		require.Same(t, defaultRouter, router)
+		require.Equal(t, defaultAuthenticator, authenticator)
+		require.Equal(t, "com.example", realm)
+	})
+}
@@ -0,0 +1,111 @@
+package xconnwebrtc
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+)
+
+// maxSerializerID is the largest id that fits the handshake's 4-bit
+// serializer field.
+const maxSerializerID = 15
+
+// serializerRegistry resolves a serializers.Serializer from the RawSocket
+// serializer id a handshake negotiates, mirroring xconn-go's internal
+// RawSocket serializer registry.
+type serializerRegistry struct {
+	byID map[transports.Serializer]serializers.Serializer
+
+	sync.RWMutex
+}
+
+var registeredSerializers = &serializerRegistry{ //nolint:gochecknoglobals
+	byID: map[transports.Serializer]serializers.Serializer{
+		transports.SerializerJson:    &serializers.JSONSerializer{},
+		transports.SerializerMsgpack: &serializers.MsgPackSerializer{},
+		transports.SerializerCbor:    &serializers.CBORSerializer{},
+	},
+}
+
+// RegisterSerializer makes serializer available under id in the magic-byte
+// handshake of every provider and client in the process, next to the
+// built-in JSON (1), MsgPack (2) and CBOR (3) ones, which it may replace.
+// Both sides must register the same serializer under the same id; on the
+// client, pass an xconn.SerializerSpec with that id.
+func RegisterSerializer(id transports.Serializer, serializer serializers.Serializer) error {
+	if id == 0 || id > maxSerializerID {
+		return fmt.Errorf("serializer id must be between 1 and %d", maxSerializerID)
+	}
+	if serializer == nil {
+		return fmt.Errorf("serializer must not be nil")
+	}
+
+	registeredSerializers.Lock()
+	defer registeredSerializers.Unlock()
+
+	registeredSerializers.byID[id] = serializer
+	return nil
+}
+
+// lookupSerializer returns the serializer registered under id.
+func lookupSerializer(id transports.Serializer) (serializers.Serializer, bool) {
+	registeredSerializers.RLock()
+	defer registeredSerializers.RUnlock()
+
+	serializer, ok := registeredSerializers.byID[id]
+	return serializer, ok
+}
+
+// registeredSerializerID returns the id serializer is registered under, or
+// else the lowest id registered with a serializer of the same type, so a
+// fresh &serializers.CBORSerializer{} resolves too.
+func registeredSerializerID(serializer serializers.Serializer) (transports.Serializer, bool) {
+	registeredSerializers.RLock()
+	defer registeredSerializers.RUnlock()
+
+	var sameType transports.Serializer
+	for id, registered := range registeredSerializers.byID {
+		if registered == serializer {
+			return id, true
+		}
+		if reflect.TypeOf(registered) == reflect.TypeOf(serializer) && (sameType == 0 || id < sameType) {
+			sameType = id
+		}
+	}
+	return sameType, sameType != 0
+}
+
+// allowsSerializer reports whether id is in allowed; an empty set allows
+// every registered serializer.
+func allowsSerializer(allowed []transports.Serializer, id transports.Serializer) bool {
+	return len(allowed) == 0 || slices.Contains(allowed, id)
+}
+
+// validateSerializers checks that every allowed id is registered.
+func validateSerializers(allowed []transports.Serializer) error {
+	for _, id := range allowed {
+		if _, ok := lookupSerializer(id); !ok {
+			return fmt.Errorf("serializer %d is not registered", id)
+		}
+	}
+	return nil
+}
+
+// validateSerializerSpecs checks that every spec a client offers is
+// registered, so a typo fails before connecting rather than in the handshake.
+func validateSerializerSpecs(specs ...xconn.SerializerSpec) error {
+	for _, spec := range specs {
+		if spec == nil {
+			return fmt.Errorf("serializer must not be nil")
+		}
+		if _, ok := lookupSerializer(transports.Serializer(spec.SerializerID())); !ok {
+			return fmt.Errorf("serializer %d is not registered", spec.SerializerID())
+		}
+	}
+	return nil
+}
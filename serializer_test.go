@@ -0,0 +1,42 @@
+package xconnwebrtc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func TestRegisterSerializer(t *testing.T) {
+	t.Cleanup(xconnwebrtc.SaveSerializers())
+
+	require.Error(t, xconnwebrtc.RegisterSerializer(0, &serializers.JSONSerializer{}))
+	require.Error(t, xconnwebrtc.RegisterSerializer(16, &serializers.JSONSerializer{}))
+	require.Error(t, xconnwebrtc.RegisterSerializer(9, nil))
+	require.NoError(t, xconnwebrtc.RegisterSerializer(transports.SerializerJson, &serializers.JSONSerializer{}))
+
+	serializer := &serializers.CBORSerializer{}
+	require.NoError(t, xconnwebrtc.RegisterSerializer(9, serializer))
+	registered, ok := xconnwebrtc.LookupSerializer(9)
+	require.True(t, ok)
+	require.Same(t, serializer, registered)
+}
+
+func TestSaveSerializers(t *testing.T) {
+	builtin, ok := xconnwebrtc.LookupSerializer(transports.SerializerJson)
+	require.True(t, ok)
+
+	restore := xconnwebrtc.SaveSerializers()
+	require.NoError(t, xconnwebrtc.RegisterSerializer(transports.SerializerJson, &serializers.JSONSerializer{}))
+	require.NoError(t, xconnwebrtc.RegisterSerializer(9, &serializers.CBORSerializer{}))
+	restore()
+
+	registered, ok := xconnwebrtc.LookupSerializer(transports.SerializerJson)
+	require.True(t, ok)
+	require.Same(t, builtin, registered)
+	_, ok = xconnwebrtc.LookupSerializer(9)
+	require.False(t, ok)
+}
@@ -0,0 +1,137 @@
+package xconnwebrtc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xconnio/wampproto-go/auth"
+	"github.com/xconnio/xconn-go"
+)
+
+const (
+	DefaultReconnectDelay    = time.Second
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+// ServeConfig configures WebRTCProvider.Serve.
+type ServeConfig struct {
+	// URL and Realm of the router the signaling session joins.
+	URL   string
+	Realm string
+	// Authenticator authenticates the signaling session; anonymous if nil.
+	Authenticator auth.ClientAuthenticator
+	// Serializer of the signaling session; xconn-go's default if nil.
+	Serializer  xconn.SerializerSpec
+	DialTimeout time.Duration
+	// Provider is passed to Setup after every (re)connect, with its Session
+	// replaced by the new signaling session.
+	Provider *ProviderConfig
+	// ReconnectDelay is the wait after the first failed or dropped
+	// connection, doubling up to MaxReconnectDelay while reconnecting fails.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// OnConnect fires after every successful Setup, OnDisconnect when the
+	// signaling session is lost or a (re)connect attempt fails.
+	OnConnect    func(session *xconn.Session)
+	OnDisconnect func(err error)
+}
+
+func (c *ServeConfig) validate() error {
+	if c == nil {
+		return fmt.Errorf("serve config is nil")
+	}
+	if c.URL == "" {
+		return fmt.Errorf("url must not be empty")
+	}
+	if c.Realm == "" {
+		return fmt.Errorf("realm must not be empty")
+	}
+	if c.Provider == nil {
+		return fmt.Errorf("provider config is nil")
+	}
+	// Fail now rather than on every reconnect; Setup validates the real one.
+	provider := *c.Provider
+	if err := provider.validateOptions(); err != nil {
+		return err
+	}
+	if c.Authenticator == nil {
+		c.Authenticator = auth.NewAnonymousAuthenticator("", nil)
+	}
+	if c.ReconnectDelay <= 0 {
+		c.ReconnectDelay = DefaultReconnectDelay
+	}
+	if c.MaxReconnectDelay < c.ReconnectDelay {
+		c.MaxReconnectDelay = max(DefaultMaxReconnectDelay, c.ReconnectDelay)
+	}
+	return nil
+}
+
+// Serve connects the provider's signaling session to an external router and
+// runs Setup on it, reconnecting and running Setup again whenever the session
+// drops or connecting fails. PeerConnections already established keep
+// running across reconnects. Serve returns once ctx is done, leaving the
+// signaling session, or if config is invalid.
+func (r *WebRTCProvider) Serve(ctx context.Context, config *ServeConfig) error {
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("invalid serve config: %w", err)
+	}
+
+	client := &xconn.Client{
+		Authenticator:  config.Authenticator,
+		SerializerSpec: config.Serializer,
+		DialTimeout:    config.DialTimeout,
+	}
+
+	logger := loggerOrDefault(config.Provider.Logger)
+	delay := config.ReconnectDelay
+	for {
+		session, err := r.serveOnce(ctx, client, config)
+		if err == nil {
+			delay = config.ReconnectDelay
+			if config.OnConnect != nil {
+				config.OnConnect(session)
+			}
+
+			select {
+			case <-session.Done():
+				err = fmt.Errorf("signaling session closed")
+			case <-ctx.Done():
+				_ = session.Leave()
+				return nil
+			}
+		}
+
+		logger.Debug("webrtc provider signaling lost, reconnecting", "url", config.URL, "delay", delay, "error", err)
+		if config.OnDisconnect != nil {
+			config.OnDisconnect(err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay = min(2*delay, config.MaxReconnectDelay)
+	}
+}
+
+// serveOnce connects a signaling session and runs Setup on it.
+func (r *WebRTCProvider) serveOnce(ctx context.Context, client *xconn.Client,
+	config *ServeConfig) (*xconn.Session, error) {
+
+	session, err := client.Connect(ctx, config.URL, config.Realm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.URL, err)
+	}
+
+	providerConfig := *config.Provider
+	providerConfig.Session = session
+	if err = r.Setup(&providerConfig); err != nil {
+		_ = session.Leave()
+		return nil, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,125 @@
+package xconnwebrtc_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+const procedureFingerprint = "io.xconn.webrtc.fingerprint"
+
+// freeAddress returns a loopback address nothing listens on.
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return address
+}
+
+// startSignaling serves an open "signaling" realm over WebSocket on address
+// and returns its router along with a function stopping both.
+func startSignaling(t *testing.T, address string) (*xconnwebrtc.LocalRouter, func()) {
+	local, err := xconnwebrtc.NewLocalRouter("signaling")
+	require.NoError(t, err)
+
+	server := xconn.NewServer(local.Router(), xconnwebrtc.NewOpenAuthenticator(), nil)
+	closer, err := server.ListenAndServeWebSocket(xconn.NetworkTCP, address)
+	require.NoError(t, err)
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			_ = closer.Close()
+			_ = local.Close()
+		})
+	}
+	t.Cleanup(stop)
+	return local, stop
+}
+
+func TestServeReconnect(t *testing.T) {
+	address := freeAddress(t)
+	_, stop := startSignaling(t, address)
+
+	const delay, maxDelay = 50 * time.Millisecond, 200 * time.Millisecond
+	connected := make(chan *xconn.Session, 4)
+	var mu sync.Mutex
+	var disconnects []time.Time
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- xconnwebrtc.NewWebRTCHandler().Serve(ctx, &xconnwebrtc.ServeConfig{
+			URL:   "ws://" + address + "/ws",
+			Realm: "signaling",
+			Provider: &xconnwebrtc.ProviderConfig{
+				ProcedureHandleOffer:        procedureWebRTCOffer,
+				TopicHandleRemoteCandidates: topicAnswererOnCandidate,
+				TopicPublishLocalCandidate:  topicOffererOnCandidate,
+				ProcedureFingerprint:        procedureFingerprint,
+			},
+			ReconnectDelay:    delay,
+			MaxReconnectDelay: maxDelay,
+			OnConnect:         func(session *xconn.Session) { connected <- session },
+			OnDisconnect: func(error) {
+				mu.Lock()
+				disconnects = append(disconnects, time.Now())
+				mu.Unlock()
+			},
+		})
+	}()
+
+	awaitConnect := func() *xconn.Session {
+		select {
+		case session := <-connected:
+			return session
+		case <-time.After(10 * time.Second):
+			t.Fatal("provider didn't connect")
+			return nil
+		}
+	}
+	first := awaitConnect()
+
+	// The signaling session drops, then reconnecting fails while the router
+	// is down, waiting twice as long after each failure up to maxDelay.
+	stop()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(disconnects) >= 5
+	}, 10*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	for i, want := range []time.Duration{delay, 2 * delay, maxDelay, maxDelay} {
+		require.GreaterOrEqual(t, disconnects[i+1].Sub(disconnects[i]), want, "attempt %d", i+1)
+	}
+	require.Less(t, disconnects[4].Sub(disconnects[3]), 2*maxDelay)
+	mu.Unlock()
+
+	// Once the router is back, the provider reconnects and registers again.
+	signaling, _ := startSignaling(t, address)
+	second := awaitConnect()
+	require.NotSame(t, first, second)
+
+	session, err := signaling.Join()
+	require.NoError(t, err)
+	callResp := session.Call(procedureFingerprint).Do()
+	require.NoError(t, callResp.Err)
+
+	cancel()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return")
+	}
+}
@@ -0,0 +1,175 @@
+package xconnwebrtc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Names of the spans a Tracer gets.
+const (
+	// SpanConnect covers ConnectWAMP, parent of the client spans below.
+	SpanConnect = "webrtc.connect"
+	// SpanOfferCreate covers creating the offer, including waiting for the
+	// candidates it carries.
+	SpanOfferCreate = "webrtc.offer.create"
+	// SpanSignalingCall covers the call to ProcedureWebRTCOffer; the provider's
+	// SpanHandleOffer is its child.
+	SpanSignalingCall = "webrtc.signaling.call"
+	// SpanAnswerApply covers applying the provider's answer.
+	SpanAnswerApply = "webrtc.answer.apply"
+	// SpanICE lasts from the answer being applied until ICE connects.
+	SpanICE = "webrtc.ice"
+	// SpanDataChannelOpen lasts until the DataChannel opens: from ICE
+	// connecting (DTLS and SCTP setup) for the first one, from its creation
+	// for the others.
+	SpanDataChannelOpen = "webrtc.datachannel.open"
+	// SpanHandshake covers the magic-byte handshake, and the key exchange
+	// with encryption.
+	SpanHandshake = "webrtc.handshake"
+	// SpanJoin covers the WAMP join over the DataChannel.
+	SpanJoin = "wamp.join"
+	// SpanOpenSession covers WebRTCSession.OpenSession and OpenSession.
+	SpanOpenSession = "webrtc.session.open"
+	// SpanHandleOffer covers the provider answering an offer.
+	SpanHandleOffer = "webrtc.offer.handle"
+	// SpanAccept covers the provider reading and authenticating a session's
+	// HELLO; it is a child of the SpanHandleOffer of its connection.
+	SpanAccept = "wamp.accept"
+)
+
+// Tracer is the hook through which connection setup is traced, small enough
+// to adapt OpenTelemetry or any other tracing system to. Trace contexts cross
+// from client to provider in the offer, injected into and extracted from a
+// string map, like OpenTelemetry's propagation.MapCarrier.
+type Tracer interface {
+	// Start starts a span named name, a child of the span in ctx, if any,
+	// and returns ctx with the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Inject writes the trace context of ctx into carrier.
+	Inject(ctx context.Context, carrier map[string]string)
+	// Extract returns ctx with the trace context read from carrier.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// Span is one timed operation of a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(context.Context, map[string]string) {}
+
+func (noopTracer) Extract(ctx context.Context, _ map[string]string) context.Context {
+	return ctx
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
+
+// tracerOrNoop returns tracer, or a Tracer that does nothing if it is nil.
+func tracerOrNoop(tracer Tracer) Tracer {
+	if tracer == nil {
+		return noopTracer{}
+	}
+	return tracer
+}
+
+// trace starts spans as children of the span in ctx.
+type trace struct {
+	tracer Tracer
+	ctx    context.Context
+}
+
+func newTrace(ctx context.Context, tracer Tracer) trace {
+	return trace{tracer: tracerOrNoop(tracer), ctx: ctx}
+}
+
+// start starts a child span and returns the trace of its own children.
+func (t trace) start(name string) (trace, Span) {
+	ctx, span := t.tracer.Start(t.ctx, name)
+	return trace{tracer: t.tracer, ctx: ctx}, span
+}
+
+// carrier returns the injected trace context, or nil if there is none.
+func (t trace) carrier() map[string]string {
+	carrier := make(map[string]string)
+	t.tracer.Inject(t.ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// endSpan ends span, recording err first if it is not nil.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// transportSpans times ICE connectivity and the opening of the first
+// DataChannel, which pion reports asynchronously through ConnectionEvents.
+type transportSpans struct {
+	trace   trace
+	ice     Span
+	channel Span
+
+	sync.Mutex
+}
+
+// startICE starts SpanICE, once the answer is applied.
+func (s *transportSpans) startICE() {
+	s.Lock()
+	defer s.Unlock()
+
+	_, s.ice = s.trace.start(SpanICE)
+}
+
+func (s *transportSpans) onEvent(event ConnectionEvent) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch event.Type {
+	case EventICEStateChanged:
+		connected := event.ICEState == webrtc.ICEConnectionStateConnected ||
+			event.ICEState == webrtc.ICEConnectionStateCompleted
+		if connected && s.ice != nil {
+			s.ice.End()
+			s.ice = nil
+			_, s.channel = s.trace.start(SpanDataChannelOpen)
+		}
+	case EventDataChannelOpened:
+		if s.channel != nil {
+			s.channel.End()
+			s.channel = nil
+		}
+	default:
+	}
+}
+
+// fail ends the spans still running with err.
+func (s *transportSpans) fail(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, span := range []Span{s.ice, s.channel} {
+		if span != nil {
+			endSpan(span, err)
+		}
+	}
+	s.ice, s.channel = nil, nil
+}
@@ -0,0 +1,148 @@
+package xconnwebrtc_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// recordedSpan is a span of a spanRecorder.
+type recordedSpan struct {
+	name  string
+	err   error
+	ended bool
+}
+
+// spanRecorder is a Tracer keeping every span it starts.
+type spanRecorder struct {
+	spans []*recordedSpan
+
+	sync.Mutex
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, xconnwebrtc.Span) {
+	r.Lock()
+	defer r.Unlock()
+
+	span := &recordedSpan{name: name}
+	r.spans = append(r.spans, span)
+	return ctx, &recorderSpan{recorder: r, span: span}
+}
+
+func (r *spanRecorder) Inject(context.Context, map[string]string) {}
+
+func (r *spanRecorder) Extract(ctx context.Context, _ map[string]string) context.Context {
+	return ctx
+}
+
+// ended returns a copy of the ended span named name, if there is one.
+func (r *spanRecorder) ended(name string) (recordedSpan, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, span := range r.spans {
+		if span.name == name && span.ended {
+			return *span, true
+		}
+	}
+	return recordedSpan{}, false
+}
+
+type recorderSpan struct {
+	recorder *spanRecorder
+	span     *recordedSpan
+}
+
+func (s *recorderSpan) SetAttribute(string, any) {}
+
+func (s *recorderSpan) RecordError(err error) {
+	s.recorder.Lock()
+	defer s.recorder.Unlock()
+
+	s.span.err = err
+}
+
+func (s *recorderSpan) End() {
+	s.recorder.Lock()
+	defer s.recorder.Unlock()
+
+	s.span.ended = true
+}
+
+// requireSpanError waits for the span named name to end and checks it
+// recorded an error matching target, or any error if target is nil.
+func requireSpanError(t *testing.T, recorder *spanRecorder, name string, target error) {
+	t.Helper()
+
+	var span recordedSpan
+	require.Eventually(t, func() bool {
+		var ok bool
+		span, ok = recorder.ended(name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "span %s did not end", name)
+	require.Error(t, span.err, "span %s", name)
+	if target != nil {
+		require.ErrorIs(t, span.err, target, "span %s", name)
+	}
+}
+
+func TestTracingFailure(t *testing.T) {
+	t.Run("HandshakeRejected", func(t *testing.T) {
+		var client spanRecorder
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{
+			Serializers: []transports.Serializer{transports.SerializerCbor},
+		})
+		config.Serializer = xconn.JSONSerializerSpec
+		config.Tracer = &client
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		require.ErrorIs(t, err, xconnwebrtc.ErrHandshakeFailed)
+
+		requireSpanError(t, &client, xconnwebrtc.SpanHandshake, xconnwebrtc.ErrHandshakeFailed)
+		requireSpanError(t, &client, xconnwebrtc.SpanConnect, xconnwebrtc.ErrHandshakeFailed)
+		_, joined := client.ended(xconnwebrtc.SpanJoin)
+		require.False(t, joined)
+	})
+
+	t.Run("JoinRejected", func(t *testing.T) {
+		var client, provider spanRecorder
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{
+			Authenticator: rejectingAuthenticator{},
+			Tracer:        &provider,
+		})
+		config.Tracer = &client
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		require.ErrorIs(t, err, xconnwebrtc.ErrJoinFailed)
+
+		requireSpanError(t, &client, xconnwebrtc.SpanJoin, xconnwebrtc.ErrJoinFailed)
+		requireSpanError(t, &client, xconnwebrtc.SpanConnect, xconnwebrtc.ErrJoinFailed)
+		requireSpanError(t, &provider, xconnwebrtc.SpanAccept, nil)
+	})
+
+	t.Run("ICETimeout", func(t *testing.T) {
+		var client spanRecorder
+		_, config := listenLoopback(t, &xconnwebrtc.ProviderConfig{})
+		// Without a single local candidate, ICE never finds a pair.
+		config.SettingEngine = func(settings *webrtc.SettingEngine) {
+			settings.SetIPFilter(func(net.IP) bool { return false })
+		}
+		config.ConnectTimeout = time.Second
+		config.Tracer = &client
+
+		_, err := xconnwebrtc.ConnectWAMP(config)
+		require.ErrorIs(t, err, xconnwebrtc.ErrICEFailed)
+
+		requireSpanError(t, &client, xconnwebrtc.SpanICE, xconnwebrtc.ErrTimeout)
+		requireSpanError(t, &client, xconnwebrtc.SpanConnect, xconnwebrtc.ErrICEFailed)
+	})
+}
@@ -0,0 +1,170 @@
+package xconnwebrtc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// DefaultTrickleCutoff is the longest TrickleModeCutoff waits for initial
+	// candidates before returning the offer or answer.
+	DefaultTrickleCutoff = 100 * time.Millisecond
+	// fullGatheringTimeout is the longest TrickleModeFull waits for ICE
+	// gathering, e.g. for an unreachable STUN or TURN server to time out.
+	fullGatheringTimeout = 5 * time.Second
+)
+
+// TrickleMode decides which local ICE candidates ride along in the SDP
+// exchange and which are trickled afterward over pub/sub. The offerer reports
+// its mode in the Offer so the answerer can mirror it.
+type TrickleMode string
+
+const (
+	// TrickleModeCutoff sends the candidates gathered before a cutoff with the
+	// SDP and trickles the rest. The cutoff ends early once the first non-host
+	// candidate arrives, so LANs aren't kept waiting on STUN.
+	TrickleModeCutoff TrickleMode = "cutoff"
+	// TrickleModeFull waits for ICE gathering to complete and sends every
+	// candidate with the SDP; nothing is trickled, unless gathering takes
+	// longer than 5 seconds: the candidates gathered so far then go with the
+	// SDP and the rest are trickled.
+	TrickleModeFull TrickleMode = "full"
+	// TrickleModeOnly sends no candidates with the SDP; every candidate is
+	// trickled as soon as it is gathered.
+	TrickleModeOnly TrickleMode = "trickle"
+)
+
+func (m TrickleMode) validate() error {
+	switch m {
+	case "", TrickleModeCutoff, TrickleModeFull, TrickleModeOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown trickle mode %q", m)
+	}
+}
+
+// orDefault resolves the zero value to TrickleModeCutoff, which is what peers
+// that predate TrickleMode do.
+func (m TrickleMode) orDefault() TrickleMode {
+	if m == "" {
+		return TrickleModeCutoff
+	}
+	return m
+}
+
+// candidateBatcher splits locally gathered candidates into the initial batch
+// sent with the SDP and the ones that must be trickled, according to a
+// TrickleMode.
+type candidateBatcher struct {
+	mode TrickleMode
+	// deadline ends the initial batch of TrickleModeCutoff, gatherDeadline
+	// that of TrickleModeFull.
+	deadline       time.Time
+	gatherDeadline time.Time
+
+	trickle bool
+	initial []webrtc.ICECandidateInit
+
+	done     chan struct{}
+	doneOnce sync.Once
+
+	sync.Mutex
+}
+
+func newCandidateBatcher(mode TrickleMode, cutoff time.Duration) *candidateBatcher {
+	if cutoff <= 0 {
+		cutoff = DefaultTrickleCutoff
+	}
+
+	now := time.Now()
+	return &candidateBatcher{
+		mode:           mode.orDefault(),
+		deadline:       now.Add(cutoff),
+		gatherDeadline: now.Add(fullGatheringTimeout),
+		trickle:        mode == TrickleModeOnly,
+		done:           make(chan struct{}),
+	}
+}
+
+// add offers a gathered candidate to the initial batch. It returns false if
+// the initial batch is already closed, in which case the caller must trickle
+// the candidate instead.
+func (b *candidateBatcher) add(candidate *webrtc.ICECandidate) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.trickle {
+		return false
+	}
+
+	switch b.mode {
+	case TrickleModeFull:
+		b.initial = append(b.initial, candidate.ToJSON())
+		return true
+	default:
+		if time.Now().After(b.deadline) {
+			return false
+		}
+
+		b.initial = append(b.initial, candidate.ToJSON())
+		// First non-host candidate signals end of the fast host phase;
+		// everything after goes through the trickle path.
+		if candidate.Typ != webrtc.ICECandidateTypeHost {
+			b.trickle = true
+			b.finish()
+		}
+		return true
+	}
+}
+
+// complete marks ICE gathering as finished. Like add, it reports whether the
+// end-of-candidates marker joined the initial batch; if not, the caller must
+// trickle it.
+func (b *candidateBatcher) complete() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.finish()
+	if b.trickle {
+		return false
+	}
+
+	b.initial = append(b.initial, endOfCandidates())
+	b.trickle = true
+	return true
+}
+
+func (b *candidateBatcher) finish() {
+	b.doneOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// wait blocks until the initial batch is complete, or its deadline passes,
+// and returns it. Any candidate added afterward is rejected so it gets
+// trickled rather than lost.
+func (b *candidateBatcher) wait() []webrtc.ICECandidateInit {
+	deadline := b.deadline
+	switch b.mode {
+	case TrickleModeOnly:
+	case TrickleModeFull:
+		deadline = b.gatherDeadline
+		fallthrough
+	default:
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-b.done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.trickle = true
+	return b.initial
+}
@@ -0,0 +1,66 @@
+package xconnwebrtc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+func testCandidate(typ webrtc.ICECandidateType) *webrtc.ICECandidate {
+	return &webrtc.ICECandidate{
+		Foundation: "1",
+		Priority:   1,
+		Address:    "192.0.2.1",
+		Protocol:   webrtc.ICEProtocolUDP,
+		Port:       5000,
+		Typ:        typ,
+		Component:  1,
+	}
+}
+
+func TestCandidateBatcher(t *testing.T) {
+	t.Run("FullComplete", func(t *testing.T) {
+		batcher := xconnwebrtc.NewCandidateBatcher(xconnwebrtc.TrickleModeFull, time.Millisecond, time.Minute)
+		require.True(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeHost)))
+		require.True(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeSrflx)))
+		require.True(t, batcher.Complete())
+
+		initial := batcher.Wait()
+		require.Len(t, initial, 3)
+		require.Empty(t, initial[2].Candidate)
+	})
+
+	t.Run("FullTimeout", func(t *testing.T) {
+		batcher := xconnwebrtc.NewCandidateBatcher(xconnwebrtc.TrickleModeFull, time.Millisecond,
+			50*time.Millisecond)
+		require.True(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeHost)))
+
+		start := time.Now()
+		initial := batcher.Wait()
+		require.Less(t, time.Since(start), 5*time.Second)
+		require.Len(t, initial, 1)
+
+		// Whatever gathering still finds is trickled.
+		require.False(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeRelay)))
+		require.False(t, batcher.Complete())
+	})
+
+	t.Run("Cutoff", func(t *testing.T) {
+		batcher := xconnwebrtc.NewCandidateBatcher(xconnwebrtc.TrickleModeCutoff, time.Minute, time.Minute)
+		require.True(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeHost)))
+		// The first non-host candidate ends the initial batch early.
+		require.True(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeSrflx)))
+		require.False(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeHost)))
+		require.Len(t, batcher.Wait(), 2)
+	})
+
+	t.Run("TrickleOnly", func(t *testing.T) {
+		batcher := xconnwebrtc.NewCandidateBatcher(xconnwebrtc.TrickleModeOnly, time.Minute, time.Minute)
+		require.False(t, batcher.Add(testCandidate(webrtc.ICECandidateTypeHost)))
+		require.Empty(t, batcher.Wait())
+	})
+}
@@ -1,15 +1,20 @@
 package xconnwebrtc
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/pion/ice/v4"
 	"github.com/pion/webrtc/v4"
 
 	"github.com/xconnio/wampproto-go/auth"
 	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/wampproto-go/transports"
 	"github.com/xconnio/xconn-go"
 )
 
@@ -23,9 +28,85 @@ const (
 	ICECredentialTypeOauth    = webrtc.ICECredentialTypeOauth
 )
 
+// ICEPolicy controls which local ICE candidates a PeerConnection gathers and
+// signals to the remote side, and through it which local addresses are
+// exposed to the signaling router and the remote peer.
+type ICEPolicy int
+
+const (
+	// ICEPolicyAll gathers and signals every candidate type.
+	ICEPolicyAll ICEPolicy = iota
+	// ICEPolicyRelay only uses TURN relay candidates, so neither LAN nor
+	// public addresses are exposed. Requires at least one TURN server.
+	ICEPolicyRelay
+	// ICEPolicyNoHost never gathers host candidates, so LAN addresses stay
+	// private while server reflexive and relay candidates are still used.
+	ICEPolicyNoHost
+	// ICEPolicyMDNS signals host candidates under random mDNS ".local" names
+	// instead of their LAN addresses.
+	ICEPolicyMDNS
+)
+
+func (p ICEPolicy) String() string {
+	switch p {
+	case ICEPolicyAll:
+		return "all"
+	case ICEPolicyRelay:
+		return "relay"
+	case ICEPolicyNoHost:
+		return "no-host"
+	case ICEPolicyMDNS:
+		return "mdns"
+	default:
+		return fmt.Sprintf("ICEPolicy(%d)", int(p))
+	}
+}
+
+// allows reports whether a locally gathered candidate may be signaled under p.
+func (p ICEPolicy) allows(candidate *webrtc.ICECandidate) bool {
+	switch p {
+	case ICEPolicyRelay:
+		return candidate.Typ == webrtc.ICECandidateTypeRelay
+	case ICEPolicyNoHost:
+		return candidate.Typ != webrtc.ICECandidateTypeHost
+	default:
+		return true
+	}
+}
+
+func (p ICEPolicy) validate(servers []webrtc.ICEServer) error {
+	switch p {
+	case ICEPolicyAll, ICEPolicyNoHost, ICEPolicyMDNS:
+		return nil
+	case ICEPolicyRelay:
+		for _, server := range servers {
+			for _, url := range server.URLs {
+				if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("relay ICE policy requires at least one TURN server")
+	default:
+		return fmt.Errorf("unknown ICE policy %d", int(p))
+	}
+}
+
 type Answer struct {
 	Candidates  []webrtc.ICECandidateInit `json:"candidates"`
 	Description webrtc.SessionDescription `json:"description"`
+	Trickle     TrickleMode               `json:"trickle,omitempty"`
+
+	// The fields below are only set in offers.
+
+	// Delivery asks the answerer to deliver its trickled candidates the
+	// given way; RequestID and SessionID carry what it needs to do so.
+	Delivery  CandidateDelivery `json:"delivery,omitempty"`
+	RequestID string            `json:"requestID,omitempty"`
+	SessionID uint64            `json:"sessionID,omitempty"`
+	// TraceContext carries the offerer's trace context, injected by its
+	// Tracer, for the provider to continue the trace.
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 type Offer = Answer
@@ -33,6 +114,11 @@ type Offer = Answer
 type OfferResponse struct {
 	RequestID string `json:"requestID"`
 	Answer    Answer `json:"answer"`
+	// AuthID and Ticket are the signaling caller's identity and the one-time
+	// ticket to join with it over the DataChannel, when the provider runs with
+	// ProviderConfig.InheritIdentity.
+	AuthID string `json:"authID,omitempty"`
+	Ticket string `json:"ticket,omitempty"`
 }
 
 type OfferConfig struct {
@@ -41,10 +127,73 @@ type OfferConfig struct {
 	Ordered                  bool
 	ID                       uint16
 	TopicAnswererOnCandidate string
+	ICEPolicy                ICEPolicy
+	TrickleMode              TrickleMode
+	TrickleCutoff            time.Duration
+	RemoteCandidateFilter    CandidateFilter
+	CandidateDelivery        CandidateDelivery
+	RequestID                string
+	SessionID                uint64
+	// Certificate is the DTLS certificate to offer with; nil generates one.
+	Certificate *webrtc.Certificate
+	// SettingEngine, if set, adjusts the PeerConnection's pion SettingEngine
+	// after ICEPolicy is applied, e.g. to gather loopback candidates when
+	// both ends run on the same machine.
+	SettingEngine func(settings *webrtc.SettingEngine)
+	// OnPeerConnection, if set, receives the PeerConnection before the offer
+	// is created, e.g. to watch its signaling or ICE gathering state. It must
+	// not replace the OnICECandidate, OnICEConnectionStateChange and
+	// OnConnectionStateChange handlers or the DTLS transport's OnStateChange,
+	// which the Offerer owns.
+	OnPeerConnection func(connection *webrtc.PeerConnection)
+	// OnEvent, if set, receives the connection's candidate, ICE, DTLS and
+	// DataChannel events; see ConnectionEvent. It is called synchronously
+	// from pion's callbacks and must not block.
+	OnEvent func(event ConnectionEvent)
+	// Logger receives the Offerer's logs, with the request and session IDs
+	// as attributes, and pion's own logs of the PeerConnection. nil logs to
+	// slog.Default() and leaves pion on its default logger.
+	Logger *slog.Logger
 }
 
 type AnswerConfig struct {
 	ICEServers []webrtc.ICEServer
+	ICEPolicy  ICEPolicy
+	// TrickleMode overrides the mode reported in the offer; leave empty to
+	// mirror the offerer.
+	TrickleMode           TrickleMode
+	RemoteCandidateFilter CandidateFilter
+	// Certificate is the DTLS certificate to answer with; nil generates one.
+	Certificate *webrtc.Certificate
+	// SettingEngine, if set, adjusts the PeerConnection's pion SettingEngine
+	// after ICEPolicy is applied, e.g. to gather loopback candidates when
+	// both ends run on the same machine.
+	SettingEngine func(settings *webrtc.SettingEngine)
+	// Encryption, if set, requires every WAMP channel to negotiate end-to-end
+	// encryption; pre-handshake clients are then no longer recognized.
+	Encryption *EncryptionConfig
+	// MaxSessions caps the WAMP sessions open at once on the connection;
+	// further handshakes are rejected with HandshakeErrorMaxConnectionCount.
+	// Zero means unlimited.
+	MaxSessions int
+	// MinMessageSize rejects handshakes announcing a smaller maximum message
+	// size with HandshakeErrorMaxLengthUnacceptable. Zero accepts any.
+	MinMessageSize int
+	// Serializers, if not empty, restricts WAMP channels to these registered
+	// serializer ids (see RegisterSerializer); others are rejected with
+	// HandshakeErrorSerializerUnsupported.
+	Serializers []transports.Serializer
+	// OnEvent, if set, receives the connection's candidate, ICE, DTLS,
+	// DataChannel and handshake events; see ConnectionEvent. It is called
+	// synchronously from pion's callbacks and must not block.
+	OnEvent func(event ConnectionEvent)
+	// Logger receives the Answerer's logs, those of its WAMP channels, and
+	// pion's own logs of the PeerConnection. nil logs to slog.Default() and
+	// leaves pion on its default logger.
+	Logger *slog.Logger
+	// Keepalive, if set, pings the offerer over every WAMP channel and closes
+	// the channel when it stops answering; see KeepaliveConfig.
+	Keepalive *KeepaliveConfig
 }
 
 type ProviderConfig struct {
@@ -57,10 +206,82 @@ type ProviderConfig struct {
 	// (see Answerer.OnWAMPDataChannel), matching what the client sends via
 	// OpenSessionConfig.Serializer / ClientConfig.Serializer. Kept for
 	// backwards API compatibility.
-	Serializer    serializers.Serializer
-	Router        *xconn.Router
+	Serializer serializers.Serializer
+	// Router receives every accepted WAMP session. If it and LocalRealm are
+	// both unset, sessions go to WebRTCProvider.OnSession instead.
+	Router *xconn.Router
+	// LocalRealm, if Router is nil, makes Setup host this realm on an embedded
+	// LocalRouter for every WAMP session arriving over the provider's
+	// PeerConnections; see WebRTCProvider.LocalRouter. Authenticator is then
+	// required; NewOpenAuthenticator admits everyone with full access.
+	LocalRealm string
+	// Upstream, if set, makes the provider a proxy: every WAMP session is
+	// forwarded message by message to an upstream router over a connection of
+	// its own, and authenticated there. Router, LocalRealm and Authenticator
+	// are then unused, and RealmResolver, InheritIdentity and Encryption,
+	// which need the provider to accept the session itself, are rejected.
+	// MaxSessions, MinMessageSize and Serializers still apply. See
+	// WebSocketUpstream and RawSocketUpstream.
+	Upstream UpstreamDialer
+	// RealmResolver, if set, picks the router, realm and authenticator for
+	// each session from its HELLO and the signaling caller of its offer,
+	// overriding Router and Authenticator.
+	RealmResolver RealmResolver
 	Authenticator auth.ServerAuthenticator
-	ICEServers    []webrtc.ICEServer
+	// InheritIdentity binds each PeerConnection's WAMP sessions to the
+	// identity of the signaling session that made its offer: the offer
+	// response carries a one-time ticket for the caller's authid and authrole
+	// (valid for IdentityTicketTTL), and sessions authenticating any other way
+	// must still end up with the caller's authid. Requires the signaling
+	// router to disclose the caller's identity.
+	InheritIdentity   bool
+	IdentityTicketTTL time.Duration
+	ICEServers        []webrtc.ICEServer
+	ICEPolicy         ICEPolicy
+	// SettingEngine is passed on to AnswerConfig.SettingEngine.
+	SettingEngine func(settings *webrtc.SettingEngine)
+	// TrickleCutoff bounds how long answers wait for initial candidates when
+	// the offerer uses TrickleModeCutoff. Defaults to DefaultTrickleCutoff.
+	TrickleCutoff         time.Duration
+	RemoteCandidateFilter CandidateFilter
+	// CandidateDelivery is the delivery the provider's clients ask for (see
+	// ClientConfig.CandidateDelivery). CandidateDeliveryEligible has the
+	// signaling router disclose each offer's caller, so candidates only go
+	// to the caller's own session rather than the one its offer names.
+	// Offers asking for another delivery are answered either way.
+	CandidateDelivery CandidateDelivery
+	// Certificate is the DTLS certificate every PeerConnection is answered
+	// with, so the provider keeps one fingerprint clients can pin (see
+	// LoadOrCreateCertificate). If nil, each PeerConnection gets a fresh one,
+	// unless ProcedureFingerprint is set.
+	Certificate *webrtc.Certificate
+	// ProcedureFingerprint, if set, is registered to return the fingerprints
+	// of Certificate as a JSON array, for clients to pin via
+	// ClientConfig.PinnedFingerprints; see FetchFingerprints. A certificate is
+	// generated for the provider's lifetime if Certificate is nil.
+	ProcedureFingerprint string
+	// Encryption, if set, encrypts every WAMP session between the client,
+	// using ClientConfig.Encryption, and the provider, which decrypts it for
+	// its router; plaintext clients are rejected. It can't be combined with
+	// Upstream; see EncryptionConfig.
+	Encryption *EncryptionConfig
+	// MaxSessions and MinMessageSize limit every PeerConnection's WAMP
+	// sessions; see AnswerConfig.
+	MaxSessions    int
+	MinMessageSize int
+	// Serializers, if not empty, restricts clients to these registered
+	// serializer ids, e.g. only transports.SerializerCbor; see
+	// RegisterSerializer.
+	Serializers []transports.Serializer
+	// Logger receives the provider's logs and, with each connection's request
+	// ID as an attribute, those of its Answerers; see AnswerConfig.Logger.
+	Logger *slog.Logger
+	// Tracer, if set, traces answering offers (SpanHandleOffer) and accepting
+	// their WAMP sessions (SpanAccept), continuing the offerer's trace.
+	Tracer Tracer
+	// Keepalive, if set, detects clients that stopped answering; see
+	// AnswerConfig.Keepalive.
+	Keepalive *KeepaliveConfig
 }
 
 func cloneICEServers(servers []webrtc.ICEServer) []webrtc.ICEServer {
@@ -81,6 +302,12 @@ func (c *ProviderConfig) validate() error {
 	if c.Session == nil {
 		return fmt.Errorf("session must not be nil")
 	}
+	return c.validateOptions()
+}
+
+// validateOptions checks everything but the session, which
+// WebRTCProvider.Serve only has after connecting.
+func (c *ProviderConfig) validateOptions() error {
 	if c.ProcedureHandleOffer == "" {
 		return fmt.Errorf("procedureHandleOffer must not be empty")
 	}
@@ -93,17 +320,82 @@ func (c *ProviderConfig) validate() error {
 	if c.Serializer == nil {
 		c.Serializer = &serializers.JSONSerializer{}
 	}
+	if err := c.ICEPolicy.validate(c.ICEServers); err != nil {
+		return err
+	}
+	if err := c.CandidateDelivery.validate(); err != nil {
+		return err
+	}
+	if c.TrickleCutoff <= 0 {
+		c.TrickleCutoff = DefaultTrickleCutoff
+	}
+	if c.IdentityTicketTTL <= 0 {
+		c.IdentityTicketTTL = DefaultIdentityTicketTTL
+	}
+	if c.Upstream == nil && c.Router == nil && c.LocalRealm != "" && c.Authenticator == nil {
+		return errNoLocalAuthenticator
+	}
+	if c.Upstream != nil && c.RealmResolver != nil {
+		return fmt.Errorf("realmResolver can't be combined with upstream: the upstream router picks the realm")
+	}
+	if c.Upstream != nil && c.InheritIdentity {
+		return fmt.Errorf("inheritIdentity can't be combined with upstream: the upstream router authenticates")
+	}
+	if c.Encryption != nil {
+		if c.Upstream != nil {
+			return fmt.Errorf("encryption can't be combined with upstream: the upstream router would see plaintext")
+		}
+		if err := c.Encryption.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Keepalive != nil {
+		if err := c.Keepalive.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateSerializers(c.Serializers); err != nil {
+		return err
+	}
 	return nil
 }
 
+// discloseCaller reports whether the offer procedure needs the signaling
+// router to disclose each offer's caller: for eligible candidate delivery, to
+// resolve realms by caller, and to inherit the caller's identity.
+func (c *ProviderConfig) discloseCaller() bool {
+	return c.CandidateDelivery == CandidateDeliveryEligible || c.RealmResolver != nil || c.InheritIdentity
+}
+
 // OpenSessionConfig configures an additional WAMP session opened via WebRTCSession.OpenSession.
 type OpenSessionConfig struct {
 	Serializer    xconn.SerializerSpec
 	Authenticator auth.ClientAuthenticator
 	OpenTimeout   time.Duration
+	// Encryption, if set, end-to-end encrypts the session; see
+	// EncryptionConfig.
+	Encryption *EncryptionConfig
+	// FallbackSerializers are tried in order when the remote side rejects
+	// Serializer as unsupported.
+	FallbackSerializers []xconn.SerializerSpec
+	// OnEvent, if set, receives the session's ConnectionEvents. Sessions
+	// opened via WebRTCSession.OpenSession default to the parent session's
+	// ClientConfig.OnEvent.
+	OnEvent func(event ConnectionEvent)
+	// Logger receives the session's logs. Sessions opened via
+	// WebRTCSession.OpenSession default to the parent session's logger,
+	// others to slog.Default().
+	Logger *slog.Logger
+	// Tracer, if set, traces opening the session under a SpanOpenSession
+	// span. Sessions opened via WebRTCSession.OpenSession default to the
+	// parent session's tracer.
+	Tracer Tracer
+	// Keepalive, if set, pings the remote over the session's DataChannel; see
+	// KeepaliveConfig.
+	Keepalive *KeepaliveConfig
 }
 
-func (c *OpenSessionConfig) validate() {
+func (c *OpenSessionConfig) validate() error {
 	if c.Serializer == nil {
 		c.Serializer = xconn.JSONSerializerSpec
 	}
@@ -113,6 +405,17 @@ func (c *OpenSessionConfig) validate() {
 	if c.OpenTimeout <= 0 {
 		c.OpenTimeout = 20 * time.Second
 	}
+	if c.Keepalive != nil {
+		if err := c.Keepalive.validate(); err != nil {
+			return err
+		}
+	}
+	return validateSerializerSpecs(c.serializerSpecs()...)
+}
+
+// serializerSpecs returns the serializers to offer, in order of preference.
+func (c *OpenSessionConfig) serializerSpecs() []xconn.SerializerSpec {
+	return append([]xconn.SerializerSpec{c.Serializer}, c.FallbackSerializers...)
 }
 
 // WebRTCSession is a WAMP session established over a WebRTC DataChannel. It
@@ -127,6 +430,17 @@ type WebRTCSession struct {
 
 	connection *webrtc.PeerConnection
 	channel    *webrtc.DataChannel
+	peer       *WebRTCPeer
+	// group holds this session and the ones opened alongside it.
+	group *sessionGroup
+	// events receives the ConnectionEvents of this session and, unless
+	// overridden, of the ones opened alongside it.
+	events *eventEmitter
+	// logger is the connection's logger, inherited by sessions opened
+	// alongside this one.
+	logger *slog.Logger
+	// tracer is the connection's Tracer, inherited likewise.
+	tracer Tracer
 }
 
 // Connection returns the underlying PeerConnection, shared across every WAMP
@@ -141,6 +455,13 @@ func (w *WebRTCSession) OpenChannel(label string, options *webrtc.DataChannelIni
 	return w.connection.CreateDataChannel(label, options)
 }
 
+// RTT returns the round-trip time of the session's DataChannel as measured by
+// its latest keepalive ping, or zero without KeepaliveConfig or before the
+// first pong.
+func (w *WebRTCSession) RTT() time.Duration {
+	return w.peer.RTT()
+}
+
 // OnDataChannel registers a callback for raw (non-WAMP) data channels the
 // remote peer opens.
 func (w *WebRTCSession) OnDataChannel(callback func(channel *webrtc.DataChannel)) {
@@ -153,21 +474,81 @@ func (w *WebRTCSession) OnDataChannel(callback func(channel *webrtc.DataChannel)
 // connection is handled by SCTP directly. Mirrors xconn.QUICSession.OpenSession
 // for QUIC connections, where many sessions can share one underlying connection.
 func (w *WebRTCSession) OpenSession(realm string, config *OpenSessionConfig) (*WebRTCSession, error) {
+	events, logger, tracer := w.events, w.logger, w.tracer
+	if config != nil && config.OnEvent != nil {
+		events = newEventEmitter(config.OnEvent, "")
+	}
+	if config != nil && config.Logger != nil {
+		logger = config.Logger
+	}
+	if config != nil && config.Tracer != nil {
+		tracer = config.Tracer
+	}
+	session, err := openSession(w.connection, realm, config, events, logger, tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	w.group.add(session)
+	return session, nil
+}
+
+// OpenSession opens a WAMP session on a new DataChannel of any established
+// PeerConnection, whichever side created it. The remote side must accept WAMP
+// data channels: a WebRTCProvider does, and so does a client that called
+// WebRTCSession.HostRealm, which lets a provider reach procedures on a client.
+func OpenSession(connection *webrtc.PeerConnection, realm string, config *OpenSessionConfig) (*WebRTCSession, error) {
+	var onEvent func(event ConnectionEvent)
+	var logger *slog.Logger
+	var tracer Tracer
+	if config != nil {
+		onEvent, logger, tracer = config.OnEvent, config.Logger, config.Tracer
+	}
+	session, err := openSession(connection, realm, config, newEventEmitter(onEvent, ""), loggerOrDefault(logger),
+		tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	newSessionGroup(session)
+	return session, nil
+}
+
+func openSession(connection *webrtc.PeerConnection, realm string, config *OpenSessionConfig,
+	events *eventEmitter, logger *slog.Logger, tracer Tracer) (*WebRTCSession, error) {
+	t, span := newTrace(context.Background(), tracer).start(SpanOpenSession)
+	session, err := openTracedSession(connection, realm, config, events, logger, t)
+	endSpan(span, err)
+	return session, err
+}
+
+func openTracedSession(connection *webrtc.PeerConnection, realm string, config *OpenSessionConfig,
+	events *eventEmitter, logger *slog.Logger, t trace) (*WebRTCSession, error) {
 	if config == nil {
 		config = &OpenSessionConfig{}
 	}
-	config.validate()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid open session config: %w", err)
+	}
 
+	start := time.Now()
+	_, channelSpan := t.start(SpanDataChannelOpen)
 	ordered := true
-	channel, err := w.connection.CreateDataChannel("data", &webrtc.DataChannelInit{
-		Ordered: &ordered,
-	})
+	options := &webrtc.DataChannelInit{Ordered: &ordered}
+	if config.Keepalive != nil {
+		protocol := keepaliveProtocol
+		options.Protocol = &protocol
+	}
+	channel, err := connection.CreateDataChannel("data", options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create data channel: %w", err)
+		err = newConnectError(PhaseSCTP, start, connection, fmt.Errorf("failed to create data channel: %w", err))
+		endSpan(channelSpan, err)
+		return nil, err
 	}
 
 	ready := make(chan struct{})
 	channel.OnOpen(func() {
+		events.emit(ConnectionEvent{Type: EventDataChannelOpened, Label: channel.Label()})
 		close(ready)
 	})
 
@@ -176,12 +557,63 @@ func (w *WebRTCSession) OpenSession(realm string, config *OpenSessionConfig) (*W
 
 	select {
 	case <-ready:
+		channelSpan.End()
 	case <-timer.C:
 		_ = channel.Close()
-		return nil, fmt.Errorf("timed out waiting for data channel to open")
+		err = newConnectError(PhaseSCTP, start, connection,
+			fmt.Errorf("%w waiting for data channel to open", ErrTimeout))
+		endSpan(channelSpan, err)
+		return nil, err
 	}
 
-	return joinWebRTCSession(w.connection, channel, realm, config.Serializer, config.Authenticator, config.OpenTimeout)
+	return joinWebRTCSession(connection, channel, &joinOptions{
+		realm:         realm,
+		specs:         config.serializerSpecs(),
+		authenticator: config.Authenticator,
+		encryption:    config.Encryption,
+		keepalive:     config.Keepalive,
+		start:         start,
+		timeout:       config.OpenTimeout,
+		events:        events,
+		logger:        logger,
+		trace:         t,
+	})
+}
+
+// HostRealm serves local's realm to the remote peer: every data channel the
+// remote opens with a magic-byte handshake becomes a WAMP session on local,
+// authenticated by authenticator (see NewOpenAuthenticator). Other data
+// channels are handed to onDataChannel with their already-consumed first
+// message, as in Answerer.OnDataChannel. HostRealm replaces any OnDataChannel
+// callback.
+func (w *WebRTCSession) HostRealm(local *LocalRouter, authenticator auth.ServerAuthenticator,
+	onDataChannel func(channel *webrtc.DataChannel, firstMessage []byte)) error {
+
+	if authenticator == nil {
+		return errNoLocalAuthenticator
+	}
+
+	w.connection.OnDataChannel(func(d *webrtc.DataChannel) {
+		acceptHandshake(d, handshakeLimits{}, w.logger, func(channel *webrtc.DataChannel,
+			serializer serializers.Serializer, _ *e2eCipher, _ bool) {
+			// Must run before this callback returns; see WebRTCProvider.Setup.
+			peer := newWebRTCPeer(channel, nil, w.logger)
+			go func() {
+				channel.OnClose(func() {
+					_ = peer.Close()
+				})
+				if err := local.Serve(peer, serializer, authenticator); err != nil {
+					w.logger.Debug("failed to serve WAMP data channel", logKeyLabel, channel.Label(), "error", err)
+				}
+			}()
+		}, func(channel *webrtc.DataChannel, firstMessage []byte) {
+			if onDataChannel != nil {
+				onDataChannel(channel, firstMessage)
+			}
+		})
+	})
+
+	return nil
 }
 
 // Close leaves the WAMP session (sending GOODBYE) and closes this session's
@@ -207,18 +639,54 @@ func outboundIPs() []net.IP {
 }
 
 func NewFilteredPeerConnection(iceServers []webrtc.ICEServer) (*webrtc.PeerConnection, error) {
+	return newPeerConnection(iceServers, ICEPolicyAll, nil, nil, nil)
+}
+
+// newPeerConnection creates a PeerConnection with policy applied. A nil
+// certificate makes pion generate a fresh one for the connection; a non-nil
+// logger receives pion's logs instead of its default logger; a non-nil
+// settings adjusts the SettingEngine last.
+func newPeerConnection(iceServers []webrtc.ICEServer, policy ICEPolicy, certificate *webrtc.Certificate,
+	logger *slog.Logger, settings func(settings *webrtc.SettingEngine)) (*webrtc.PeerConnection, error) {
 	config := webrtc.Configuration{
 		ICEServers:           iceServers,
 		ICECandidatePoolSize: 10,
 	}
+	if certificate != nil {
+		config.Certificates = []webrtc.Certificate{*certificate}
+	}
 
 	s := webrtc.SettingEngine{}
+	if logger != nil {
+		s.LoggerFactory = pionLoggerFactory{logger: logger}
+	}
 
-	routable := outboundIPs()
-	if len(routable) > 0 {
-		s.SetIPFilter(func(ip net.IP) bool {
+	var ipFilter func(ip net.IP) bool
+	if routable := outboundIPs(); len(routable) > 0 {
+		ipFilter = func(ip net.IP) bool {
 			return slices.ContainsFunc(routable, ip.Equal)
-		})
+		}
+	}
+
+	switch policy {
+	case ICEPolicyRelay:
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	case ICEPolicyNoHost:
+		// Only host candidates are gathered from local addresses; server
+		// reflexive and relay candidates use sockets of their own.
+		ipFilter = func(net.IP) bool {
+			return false
+		}
+	case ICEPolicyMDNS:
+		s.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryAndGather)
+	default:
+	}
+
+	if ipFilter != nil {
+		s.SetIPFilter(ipFilter)
+	}
+	if settings != nil {
+		settings(&s)
 	}
 
 	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
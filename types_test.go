@@ -0,0 +1,61 @@
+package xconnwebrtc_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/xconn-webrtc-go"
+)
+
+// gatherCandidates returns the candidate lines of an offer gathered under
+// policy, with settings applied to its SettingEngine.
+func gatherCandidates(t *testing.T, policy xconnwebrtc.ICEPolicy,
+	settings func(settings *webrtc.SettingEngine)) []string {
+
+	connection, err := xconnwebrtc.NewPeerConnection(nil, policy, nil, nil, settings)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = connection.Close() })
+
+	_, err = connection.CreateDataChannel("data", nil)
+	require.NoError(t, err)
+	offer, err := connection.CreateOffer(nil)
+	require.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(connection)
+	require.NoError(t, connection.SetLocalDescription(offer))
+	select {
+	case <-gathered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("ICE gathering didn't complete")
+	}
+
+	var candidates []string
+	for _, line := range strings.Split(connection.LocalDescription().SDP, "\n") {
+		if strings.HasPrefix(line, "a=candidate:") {
+			candidates = append(candidates, strings.TrimSpace(line))
+		}
+	}
+	return candidates
+}
+
+func TestICEPolicyNoHost(t *testing.T) {
+	includeLoopback := func(settings *webrtc.SettingEngine) {
+		settings.SetIncludeLoopbackCandidate(true)
+		settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	}
+
+	candidates := gatherCandidates(t, xconnwebrtc.ICEPolicyAll, func(settings *webrtc.SettingEngine) {
+		includeLoopback(settings)
+		settings.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	})
+	require.NotEmpty(t, candidates)
+	for _, candidate := range candidates {
+		require.Contains(t, candidate, "typ host")
+	}
+
+	require.Empty(t, gatherCandidates(t, xconnwebrtc.ICEPolicyNoHost, includeLoopback))
+}